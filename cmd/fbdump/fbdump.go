@@ -0,0 +1,75 @@
+// Command fbdump saves what is on a frame buffer as a PNG.  It works on a
+// real device such as /dev/fb0 or on a virtual one made by gophoto with
+// -display fb:/tmp/gophoto.fb, so a headless run can be looked at.
+//
+//	fbdump -o frame.png /tmp/gophoto.fb
+//	fbdump -o frame%04d.png -every 5s /tmp/gophoto.fb
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/fb"
+)
+
+func main() {
+	out := flag.String("o", "framebuffer.png", "PNG to write, a name with a verb like %04d makes a numbered sequence")
+	every := flag.Duration("every", 0, "keep dumping this often, 0 for once")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: fbdump [flags] [device]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	path := "/dev/fb0"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+	dev, err := fb.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dev.Close()
+
+	for n := 0; ; n++ {
+		name := *out
+		if strings.ContainsRune(name, '%') {
+			name = fmt.Sprintf(name, n)
+		}
+		if err := dump(dev, name); err != nil {
+			log.Fatal(err)
+		}
+		if *every <= 0 {
+			return
+		}
+		time.Sleep(*every)
+	}
+}
+
+// Writes the visible part of the frame buffer to name
+func dump(dev *fb.Device, name string) error {
+	// Asked for each time as a virtual frame buffer may have changed mode or
+	// been panned
+	img, err := dev.Image()
+	if err != nil {
+		return err
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, rgba); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -9,32 +9,29 @@ package main
 import (
 	"fmt"
 	"image"
-	"os"
-
-	"image/draw"
-	"image/png"
+	"log"
 
 	_ "embed"
 	_ "image/png"
 
+	"github.com/drummonds/gophoto/internal/display"
 	"github.com/drummonds/gophoto/internal/frame"
 )
 
 func main() {
 	fmt.Print(("Hello\n"))
-	mockFrameBuffer := image.NewRGBA(image.Rectangle{image.Point{0, 0}, image.Point{1920, 1080}})
+	d := display.NewPNG("framebuffer.png", image.Rect(0, 0, 1920, 1080))
 
-	pf := frame.NewPictureFrame(mockFrameBuffer.Bounds())
+	pf := frame.NewPictureFrame(d.Bounds())
 
 	// pf.SetupBoundedStaticImage()
 	pf.SetupFullStaticImage()
 	// err = pf.SetupFullPhotoPrism()
 
-	// Copy intermediate buffer to frame buffer
 	pf.RenderPhotoPrism()
 	// pf.Render()
-	draw.Draw(mockFrameBuffer, pf.Bounds, pf.Buffer, image.Point{}, draw.Src)
 	// Encode frame buffer as PNG and save
-	f, _ := os.Create("framebuffer.png")
-	png.Encode(f, mockFrameBuffer)
+	if err := d.Present(pf.Buffer); err != nil {
+		log.Fatal(err)
+	}
 }
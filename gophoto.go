@@ -9,20 +9,32 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
-	"image/draw"
 	"log"
+	"math"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/drummonds/gophoto/internal/backlight"
 	"github.com/drummonds/gophoto/internal/console"
+	"github.com/drummonds/gophoto/internal/control"
+	"github.com/drummonds/gophoto/internal/display"
 	"github.com/drummonds/gophoto/internal/drawing"
-	"github.com/drummonds/gophoto/internal/fb"
-	"github.com/drummonds/gophoto/internal/fbimage"
 	"github.com/drummonds/gophoto/internal/frame"
+	"github.com/drummonds/gophoto/internal/meta"
+	"github.com/drummonds/gophoto/internal/monitor"
+	"github.com/drummonds/gophoto/internal/overrides"
+	"github.com/drummonds/gophoto/internal/presence"
+	"github.com/drummonds/gophoto/internal/schedule"
+	"github.com/drummonds/gophoto/internal/settings"
 	"github.com/drummonds/gophoto/internal/web"
 	"github.com/go-ping/ping"
 
@@ -32,32 +44,73 @@ import (
 
 type ConsolePicture struct {
 	// config
-	frameBuffer draw.Image // This is what is output to the screen via the frame buffer
-	pf          *frame.PictureFrame
+	display   display.Display // Where the frame is shown
+	pf        *frame.PictureFrame
+	layout    *frame.Layout
+	applied   settings.Settings      // As last set up, to see what has changed
+	presence  <-chan presence.Change // Audience chosen by who is home
+	screen    <-chan monitor.Status  // Whether a screen is plugged in
+	fixed     bool                   // Resolution set by FB_RESOLUTION, not the screen
+	schedule  *schedule.Schedule     // When the screen is on, always if nil
+	backlight *backlight.Backlight   // Dimmed for brightness instead of the pixels, if there is one
 
 	// state
-	slowPathNotified     bool
+	history              []*frame.Photo     // Recently shown, for going back
+	shown                int                // Index in history of the photo on the screen
+	histories            map[string]viewing // Of the audiences not looking now, by name
+	paused               bool
+	screenOff            bool               // Nothing plugged in, so nothing is fetched
+	blanked              bool               // Off for the night by the schedule, nothing is fetched
+	wokenUntil           time.Time          // Woken from the remote during the night
+	retry                <-chan time.Time   // To try again soon when no photo was ready
+	adjustment           drawing.Adjustment // Of the colours as last worked out
+	lut                  *drawing.LUT       // For the adjustment, nil if there is none
+	adjusted             *image.RGBA        // The frame through the LUT, as sent to the screen
+	backlit              float64            // Brightness the backlight was set to
+	ownBacklit           float64            // Of the backlight as found, kept when none is set
+	interval             time.Duration      // Between photos
 	last                 [][][]string
 	lastRender, lastCopy time.Duration
 	renderCount          int
 }
 
 // Called once to set up newConsole
-func newConsolePicture(devFrameBuffer draw.Image) (*ConsolePicture, error) {
+func newConsolePicture(ctx context.Context, d display.Display) (*ConsolePicture, error) {
 	cp := new(ConsolePicture)
-	cp.frameBuffer = devFrameBuffer
+	cp.display = d
+	cp.applied = settings.Current()
+	cp.adjustment = drawing.NoAdjustment
+	cp.interval = defaultInterval
+	if cp.applied.Interval != 0 {
+		cp.interval = time.Duration(cp.applied.Interval)
+	}
 
-	cp.pf = frame.NewPictureFrame(cp.frameBuffer.Bounds())
+	cp.pf = frame.NewPictureFrame(d.Bounds())
+	layout, err := frame.LoadLayout(layoutName(cp.applied))
+	if err != nil {
+		return cp, err
+	}
+	if err := cp.pf.ApplyLayout(ctx, layout); err != nil {
+		return cp, err
+	}
+	cp.layout = layout
 
 	// cp.pf.SetupBoundedStaticImage()
 	// cp.pf.SetupFullStaticImage()
 	// err = cp.pf.SetupFullPhotoPrism()
-	ctx := context.Background()
-	err := frame.NewPhotoPrism(ctx)
+	err = frame.NewPhotoPrism(ctx)
 	log.Printf("Done newConsolePicture %s\n", time.Now().Format(time.RFC3339))
 	return cp, err
 }
 
+// The layout in the settings, photo if there isn't one
+func layoutName(s settings.Settings) string {
+	if s.Layout == "" {
+		return "photo"
+	}
+	return s.Layout
+}
+
 // repaint any live panels to buffer
 // Call rerender
 func (cp *ConsolePicture) render(ctx context.Context) error {
@@ -77,112 +130,635 @@ func (cp *ConsolePicture) render(ctx context.Context) error {
 	t2 := time.Now()
 	// cp.pf.Render()
 	// Refresh the image and redraw
-	frame.GlobalPage.PhotoIndex++
-	if frame.GlobalPage.PhotoIndex >= len(frame.GlobalPhotoList) {
-		frame.GlobalPage.PhotoIndex = 0
+	if cp.shown+1 < len(cp.history) {
+		// Going forward again after going back
+		cp.shown++
+	} else {
+		frame.GlobalPage.PhotoIndex++
+		if frame.GlobalPage.PhotoIndex >= len(frame.GlobalPhotoList) {
+			frame.GlobalPage.PhotoIndex = 0
+		}
+		log.Printf("Get new image %s\n", time.Now().Format(time.RFC3339))
+		photo, err := frame.NewPhoto(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Got new image %s\n", time.Now().Format(time.RFC3339))
+		cp.addToHistory(photo)
 	}
-	log.Printf("Get new image %s\n", time.Now().Format(time.RFC3339))
-	img, err := frame.NewImage(ctx, cp.frameBuffer.Bounds())
-	if err != nil {
-		return err
+	cp.show()
+	cp.lastRender = time.Since(t2)
+	log.Printf("%s Completed render %v ", time.Now().Format(time.RFC3339), cp.lastCopy)
+	return nil
+}
+
+// What an audience has been shown, kept while another is looking
+type viewing struct {
+	history []*frame.Photo
+	shown   int
+}
+
+// How many photos can be gone back through
+const maxHistory = 10
+
+// Make photo the one on the screen.  Any photos gone back past are
+// forgotten.
+func (cp *ConsolePicture) addToHistory(photo *frame.Photo) {
+	if cp.shown+1 < len(cp.history) {
+		cp.history = cp.history[:cp.shown+1]
 	}
-	log.Printf("Got new image %s\n", time.Now().Format(time.RFC3339))
-	b := img.Bounds()
-	m := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
-	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
-	cp.pf.Buffer = m
+	cp.history = append(cp.history, photo)
+	if len(cp.history) > maxHistory {
+		cp.history = cp.history[1:]
+	}
+	cp.shown = len(cp.history) - 1
+}
 
-	log.Printf("%s Got image", time.Now().Format(time.RFC3339))
+// Scale the current photo to the frame and show it
+func (cp *ConsolePicture) show() {
+	if cp.shown < 0 || cp.shown >= len(cp.history) {
+		cp.redraw()
+		return
+	}
+	photo := cp.history[cp.shown]
+	cp.pf.SetPhoto(frame.ScalePhoto(photo, cp.pf.PhotoRect()))
+	cp.pf.SetInfo(photo.Meta)
+	cp.redraw()
+}
 
-	cp.lastRender = time.Since(t2)
+// Lay the frame out again for a new screen size
+func (cp *ConsolePicture) relayout(ctx context.Context, bounds image.Rectangle) error {
+	if err := cp.pf.Close(); err != nil {
+		log.Printf("Closing old frame: %v", err)
+	}
+	cp.pf = frame.NewPictureFrame(bounds)
+	if err := cp.pf.ApplyLayout(ctx, cp.layout); err != nil {
+		return err
+	}
+	cp.show()
+	return nil
+}
 
+// Composite the panels over the current photo and copy to the screen.  This
+// is all that is needed when only an overlay such as the clock has changed.
+func (cp *ConsolePicture) redraw() {
+	cp.pf.RepaintBackground()
+	cp.pf.RenderPanels()
+	cp.copyToScreen()
+}
+
+// Copy the frame to the screen, only the rects given if there are any.  The
+// colours are adjusted on the way.
+func (cp *ConsolePicture) copyToScreen(rects ...image.Rectangle) {
+	if cp.blanked {
+		return // Keep the clock from lighting it up
+	}
 	t3 := time.Now()
-	// NOTE: This code path is NOT using double buffering (which is done
-	// using the pan ioctl when using the frame buffer), but in practice
-	// updates seem smooth enough, most likely because we are only
-	// updating timestamps.
-	switch x := cp.frameBuffer.(type) {
-	case *fbimage.BGR565:
-		if cp.renderCount < 3 {
-			log.Printf("framebuffer using pixel format BGR565")
-		}
-		drawing.CopyRGBAtoBGR565(x, cp.pf.Buffer)
-	case *fbimage.BGRA:
-		if cp.renderCount < 3 {
-			log.Printf("framebuffer using pixel format BGRA")
-		}
-		drawing.CopyRGBAtoBGRA(x, cp.pf.Buffer)
-	default:
-		if !cp.slowPathNotified {
-			if cp.renderCount < 3 {
-				log.Printf("framebuffer not using pixel format BGR565, falling back to slow path for devFrameBuffer type %T", cp.frameBuffer)
-			}
-			cp.slowPathNotified = true
+	img := cp.pf.Buffer
+	if cp.lut != nil {
+		if cp.adjusted == nil || cp.adjusted.Rect != img.Rect {
+			cp.adjusted = image.NewRGBA(img.Rect)
+			rects = nil // All of it into the new one
 		}
-		draw.Draw(cp.frameBuffer, cp.pf.Bounds, cp.pf.Buffer, image.Point{}, draw.Src)
+		cp.lut.Apply(cp.adjusted, img, rects...)
+		img = cp.adjusted
+	}
+	if err := cp.display.Present(img, rects...); err != nil {
+		log.Printf("Showing frame: %v", err)
 	}
+	web.PublishFrame(img, rects...)
 	cp.lastCopy = time.Since(t3)
-	log.Printf("%s Completed render %v ", time.Now().Format(time.RFC3339), cp.lastCopy)
-	return nil
 }
 
-func gophoto(ctx context.Context) error {
-	log.Printf("Starting gophoto %s\n", time.Now().Format(time.RFC3339))
+// How long each photo is shown unless changed from the remote
+const defaultInterval = 15 * time.Second
 
-	// Take over the frame buffer and cleanup afterwards
-	cons, err := console.LeaseForGraphics()
-	if err != nil {
-		return err
+// How soon to look again for a photo when none was ready
+const noPhotoRetry = 2 * time.Second
+
+// The event loop.  A new photo is shown every interval unless paused, the
+// frame is redrawn as widgets change and commands from the display's keyboard
+// and the web remote are followed, until ctx is cancelled.
+func (cp *ConsolePicture) run(ctx context.Context, cons *console.Handle) {
+	ticker := time.NewTicker(cp.interval)
+	defer ticker.Stop()
+	var keys <-chan control.Command
+	if c, ok := cp.display.(display.Commander); ok {
+		keys = c.Commands()
 	}
-	log.Printf("Got console lease %s\n", time.Now().Format(time.RFC3339))
-	defer func() {
-		// Seems to generate VT_DISALLOCATE(2): device or resource busy
-		if err := cons.Cleanup(); err != nil {
+	var resized <-chan image.Rectangle
+	if r, ok := cp.display.(display.Resizer); ok {
+		resized = r.Resized()
+	}
+	var minutes <-chan time.Time
+	if cp.schedule != nil {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		minutes = t.C
+	}
+
+	cp.checkSchedule(ctx, time.Now(), cons)
+	cp.adjust(time.Now())
+	cp.next(ctx, cons)
+	for {
+		cp.publishState()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !cp.paused {
+				cp.next(ctx, cons)
+			}
+		case <-cp.retry:
+			cp.next(ctx, cons)
+		case c := <-keys:
+			cp.command(ctx, c, cons)
+			ticker.Reset(cp.interval)
+		case c := <-web.Commands():
+			cp.command(ctx, c, cons)
+			ticker.Reset(cp.interval)
+		case now := <-minutes:
+			cp.checkSchedule(ctx, now, cons)
+			cp.adjust(now)
+		case s := <-cp.screen:
+			cp.screenChanged(ctx, s, cons)
+		case c := <-cp.presence:
+			cp.presenceChanged(c)
+		case <-settings.Changed():
+			cp.applySettings(ctx, cons)
+			ticker.Reset(cp.interval)
+		case <-cons.Redraw():
+			// Switched back to our console
+			cp.redraw()
+		case bounds := <-resized:
+			log.Printf("Display resized to %dx%d", bounds.Dx(), bounds.Dy())
+			if err := cp.relayout(ctx, bounds); err != nil {
+				log.Printf("Laying out for new size: %v", err)
+			}
+		case <-cp.pf.Changed():
+			damage := cp.pf.RenderDamage()
+			if cons.Visible() && len(damage) > 0 {
+				cp.copyToScreen(damage...)
+			}
+		}
+	}
+}
+
+// Nobody can see the screen, so the slideshow stops and nothing is fetched
+func (cp *ConsolePicture) asleep() bool {
+	return cp.screenOff || cp.blanked
+}
+
+// Show the next photo if anyone can see it
+func (cp *ConsolePicture) next(ctx context.Context, cons *console.Handle) {
+	cp.retry = nil
+	if !cons.Visible() || cp.asleep() {
+		return
+	}
+	err := cp.render(ctx)
+	if errors.Is(err, frame.ErrNoPhotoQueued) {
+		// Keep the old photo and look again soon, without holding up the loop
+		log.Print(err)
+		cp.retry = time.After(noPhotoRetry)
+	} else if err != nil {
+		log.Printf("Failed to render %+v", err)
+	}
+}
+
+// Follow a command, the next photo is due an interval after it
+func (cp *ConsolePicture) command(ctx context.Context, c control.Command, cons *console.Handle) {
+	log.Printf("Command %v", c)
+	switch c.Action {
+	case control.Next:
+		cp.next(ctx, cons)
+	case control.Previous:
+		if cp.shown > 0 {
+			cp.shown--
+			cp.show()
+		}
+	case control.Pause:
+		cp.paused = true
+	case control.Resume:
+		cp.paused = false
+	case control.TogglePause:
+		cp.paused = !cp.paused
+	case control.SetInterval:
+		if err := c.Validate(); err != nil {
 			log.Print(err)
+			return
 		}
-	}()
-	log.Printf("Got console lease %s\n", time.Now().Format(time.RFC3339))
-	dev, err := fb.Open("/dev/fb0")
-	if err != nil {
+		cp.interval = c.Interval
+		// Keep it as the settings page would
+		s := settings.Current()
+		s.Interval = settings.Seconds(c.Interval)
+		cp.applied.Interval = s.Interval
+		if err := settings.Set(s); err != nil {
+			log.Printf("Saving interval: %v", err)
+		}
+	case control.Show:
+		photo, err := frame.GetPhotoByUID(ctx, c.UID)
+		if err != nil {
+			log.Printf("Showing %s: %v", c.UID, err)
+			return
+		}
+		cp.addToHistory(photo)
+		cp.show()
+	case control.Wake:
+		if !cp.blanked {
+			return
+		}
+		d := c.Interval
+		if d == 0 {
+			d = cp.schedule.WakeFor
+		}
+		cp.wokenUntil = time.Now().Add(d)
+		log.Printf("Woken until %s", cp.wokenUntil.Format("15:04"))
+		cp.checkSchedule(ctx, time.Now(), cons)
+	case control.Favourite, control.Like, control.Dislike, control.Rate, control.Hide:
+		if err := cp.judge(ctx, c, cons); err != nil {
+			log.Printf("%v: %v", c, err)
+		}
+	}
+}
+
+// Record what is thought of the photo on the screen.  A hidden photo is
+// forgotten and the next one shown.
+func (cp *ConsolePicture) judge(ctx context.Context, c control.Command, cons *console.Handle) error {
+	if err := c.Validate(); err != nil {
 		return err
 	}
-	log.Printf("Got FB %s\n", time.Now().Format(time.RFC3339))
+	if cp.shown < 0 || cp.shown >= len(cp.history) {
+		return fmt.Errorf("no photo is being shown")
+	}
+	photo := cp.history[cp.shown]
+	if c.UID != "" && c.UID != photo.UID {
+		return fmt.Errorf("photo %s is no longer being shown", c.UID)
+	}
+	switch c.Action {
+	case control.Favourite:
+		return frame.SetFavourite(ctx, photo, !frame.IsFavourite(photo))
+	case control.Like, control.Dislike:
+		rating := frame.Rating(photo)
+		if rating == 0 {
+			rating = (control.MaxRating + 1) / 2 // Unrated is in the middle
+		}
+		if c.Action == control.Like {
+			rating = min(rating+1, control.MaxRating)
+		} else {
+			rating = max(rating-1, 1)
+		}
+		return frame.SetRating(ctx, photo, rating)
+	case control.Rate:
+		return frame.SetRating(ctx, photo, c.Rating)
+	case control.Hide:
+		err := frame.Hide(ctx, photo)
+		// Gone from every audience's history so Previous can't bring it back
+		for name, v := range cp.histories {
+			v.history, v.shown = without(v.history, v.shown, photo.UID)
+			cp.histories[name] = viewing{v.history, min(v.shown, len(v.history)-1)}
+		}
+		cp.history, cp.shown = without(cp.history, cp.shown, photo.UID)
+		if cp.shown < len(cp.history) {
+			cp.show() // Had gone back, so show the one after it
+			return err
+		}
+		cp.shown = len(cp.history) - 1 // -1 if there are none
+		cp.next(ctx, cons)
+		return err
+	}
+	return nil
+}
+
+// Use settings changed on the web settings page.  Only what has changed is
+// redone, a new playlist shows a photo from it straight away.
+func (cp *ConsolePicture) applySettings(ctx context.Context, cons *console.Handle) {
+	s := settings.Current()
+	log.Printf("Settings changed to %+v", s)
+	old := cp.applied
+	cp.applied = s
+	if s.Interval != old.Interval {
+		cp.interval = defaultInterval
+		if s.Interval != 0 {
+			cp.interval = time.Duration(s.Interval)
+		}
+	}
+	if layoutName(s) != layoutName(old) {
+		layout, err := frame.LoadLayout(layoutName(s))
+		if err != nil {
+			log.Printf("Changing layout: %v", err)
+		} else {
+			cp.layout = layout
+			if err := cp.relayout(ctx, cp.pf.Buffer.Rect); err != nil {
+				log.Printf("Changing layout: %v", err)
+			}
+		}
+	}
+	if s.Colour != old.Colour {
+		cp.adjust(time.Now())
+	}
+	if s.Fit != old.Fit {
+		frame.GlobalPage.Fill = s.Fit == "fill"
+		cp.show()
+	}
+	audienceChanged := !reflect.DeepEqual(s.ActiveAudience(), old.ActiveAudience())
+	if !s.Playlist.Equal(old.Playlist) || audienceChanged {
+		// Histories are switched even while asleep, only fetching waits
+		if !cp.asleep() {
+			frame.SetPlaylist(ctx, s.Playlist, s.ActiveAudience())
+		}
+		switch {
+		case s.Audience != old.Audience && cp.switchAudience(old, s):
+			cp.show() // Where they were
+		case cp.asleep():
+			cp.history = cp.history[:min(cp.shown+1, len(cp.history))] // Don't go forward to the old playlist
+			cp.forgetShown()
+		default:
+			cp.history = cp.history[:min(cp.shown+1, len(cp.history))]
+			cp.next(ctx, cons)
+		}
+	}
+}
 
-	if info, err := dev.VarScreeninfo(); err == nil {
-		log.Printf("framebuffer screeninfo: %+v", info)
+// Take the photo off the frame as it isn't for the playlist or audience any
+// more, so it isn't shown on waking.  Going back still shows the ones before.
+func (cp *ConsolePicture) forgetShown() {
+	cp.shown = len(cp.history)
+	cp.pf.SetPhoto(nil)
+	cp.pf.SetInfo(meta.Info{})
+}
+
+// The screen has been unplugged or plugged in.  While there is none the
+// slideshow stops and no photos are fetched.  When one is plugged in the
+// frame is laid out for its native resolution, if the display can change.
+func (cp *ConsolePicture) screenChanged(ctx context.Context, s monitor.Status, cons *console.Handle) {
+	web.SetStatus("Screen", s.String())
+	switch {
+	case !s.Connected && !cp.screenOff:
+		log.Printf("Screen unplugged, stopping the slideshow")
+		if !cp.asleep() {
+			frame.StopPlaylist()
+		}
+		cp.screenOff = true
+	case s.Connected && cp.screenOff:
+		log.Printf("Screen %v plugged in", s)
+		cp.screenOff = false
+		if sizer, ok := cp.display.(display.Sizer); ok && s.Width > 0 && !cp.fixed {
+			if _, err := sizer.SetSize(s.Width, s.Height); err != nil {
+				log.Printf("Changing to %dx%d: %v", s.Width, s.Height, err)
+			}
+		}
+		if b := cp.display.Bounds(); b != cp.pf.Buffer.Rect && !b.Empty() {
+			if err := cp.relayout(ctx, b); err != nil {
+				log.Printf("Laying out for new screen: %v", err)
+			}
+		}
+		if !cp.asleep() {
+			frame.SetPlaylist(ctx, cp.applied.Playlist, cp.applied.ActiveAudience())
+			cp.next(ctx, cons)
+		}
 	}
+}
 
-	devFrameBuffer, err := dev.Image()
+// Blank or unblank the screen if the schedule says so, or it has been woken
+// from the remote.  While blanked the slideshow stops and nothing is
+// fetched.  Displays that can't be switched off are shown black.
+func (cp *ConsolePicture) checkSchedule(ctx context.Context, now time.Time, cons *console.Handle) {
+	on := cp.schedule.On(now) || now.Before(cp.wokenUntil)
+	if on != cp.blanked {
+		return
+	}
+	blanker, canBlank := cp.display.(display.Blanker)
+	if !on {
+		log.Printf("Blanking the screen for the night")
+		if !cp.asleep() {
+			frame.StopPlaylist()
+		}
+		black := image.NewRGBA(cp.pf.Buffer.Rect)
+		if err := cp.display.Present(black); err != nil {
+			log.Printf("Blacking the screen: %v", err)
+		}
+		web.PublishFrame(black)
+		cp.blanked = true
+		cp.wokenUntil = time.Time{}
+		if canBlank {
+			if err := blanker.Blank(true); err != nil {
+				log.Printf("Blanking the screen: %v", err)
+			}
+		}
+		web.SetStatus("Schedule", "screen off since "+now.Format("15:04"))
+		return
+	}
+	log.Printf("Screen on")
+	cp.blanked = false
+	if canBlank {
+		if err := blanker.Blank(false); err != nil {
+			log.Printf("Unblanking the screen: %v", err)
+		}
+	}
+	web.SetStatus("Schedule", "screen on since "+now.Format("15:04"))
+	if !cp.asleep() {
+		frame.SetPlaylist(ctx, cp.applied.Playlist, cp.applied.ActiveAudience())
+		cp.redraw()
+		cp.next(ctx, cons)
+	}
+}
+
+// Work out the colour adjustment from the settings and how far into the
+// night it is.  Brightness is the backlight's if there is one.  The whole
+// frame is copied to the screen again if it has changed.
+func (cp *ConsolePicture) adjust(now time.Time) {
+	c := cp.applied.Colour
+	a := drawing.NoAdjustment
+	if c.Contrast != 0 {
+		a.Contrast = float64(c.Contrast) / 100
+	}
+	if c.Gamma != 0 {
+		a.Gamma = c.Gamma
+	}
+	if c.Night != 0 {
+		// In steps so it isn't redone every minute as it comes in
+		k := a.Kelvin + (float64(c.Night)-a.Kelvin)*cp.schedule.Night(now)
+		a.Kelvin = math.Round(k/100) * 100
+	}
+	brightness := float64(c.Brightness) / 100
+	if cp.backlight == nil {
+		if c.Brightness != 0 {
+			a.Brightness = brightness
+		}
+	} else {
+		if c.Brightness == 0 {
+			brightness = cp.ownBacklit // Left as it was
+		}
+		if brightness != cp.backlit {
+			if err := cp.backlight.SetBrightness(brightness); err != nil {
+				log.Printf("Setting the backlight: %v", err)
+			}
+			cp.backlit = brightness
+		}
+	}
+	if a == cp.adjustment {
+		return
+	}
+	log.Printf("Adjusting colours by %+v", a)
+	cp.adjustment, cp.lut = a, a.LUT()
+	cp.copyToScreen()
+}
+
+// Someone has come home or everyone has gone, switch to their audience.  It
+// is saved like choosing it on /audiences, which then applies it.
+func (cp *ConsolePicture) presenceChanged(c presence.Change) {
+	home := "nobody"
+	if len(c.Home) > 0 {
+		home = strings.Join(c.Home, ", ")
+	}
+	web.SetStatus("Home", home)
+	s := settings.Current()
+	if s.Audience == c.Audience {
+		return
+	}
+	log.Printf("%s home so showing to %q", home, c.Audience)
+	s.Audience = c.Audience
+	if err := settings.Set(s); err != nil {
+		log.Printf("Choosing audience for who is home: %v", err)
+	}
+}
+
+// Keep the history of the audience that was looking and bring back that of
+// the one looking now, true if there is a photo to go back to.  Histories
+// are forgotten if the audience's rules change, as they might have photos
+// it may no longer see.
+func (cp *ConsolePicture) switchAudience(old, s settings.Settings) bool {
+	log.Printf("Audience is now %q", s.Audience)
+	if cp.histories == nil {
+		cp.histories = make(map[string]viewing)
+	}
+	cp.histories[old.Audience] = viewing{cp.history, cp.shown}
+	for name := range cp.histories {
+		before, now := old, s
+		before.Audience, now.Audience = name, name
+		if !reflect.DeepEqual(before.ActiveAudience(), now.ActiveAudience()) {
+			delete(cp.histories, name)
+		}
+	}
+	v, ok := cp.histories[s.Audience]
+	delete(cp.histories, s.Audience)
+	cp.history, cp.shown = v.history, v.shown
+	return ok && cp.shown >= 0 && cp.shown < len(cp.history)
+}
+
+// The history without the photo uid, and where the one shown has moved to.
+// If it was the photo it is the one after, which may be past the end.
+func without(history []*frame.Photo, shown int, uid string) ([]*frame.Photo, int) {
+	var kept []*frame.Photo
+	for i, p := range history {
+		if p.UID != uid {
+			kept = append(kept, p)
+		} else if i < shown {
+			shown--
+		}
+	}
+	return kept, shown
+}
+
+// Tell the web remote what is going on
+func (cp *ConsolePicture) publishState() {
+	s := control.State{Paused: cp.paused, Interval: cp.interval}
+	if cp.shown >= 0 && cp.shown < len(cp.history) {
+		photo := cp.history[cp.shown]
+		s.UID, s.Title = photo.UID, photo.Meta.Title
+		s.Favourite, s.Rating = frame.IsFavourite(photo), frame.Rating(photo)
+	}
+	s.Audience = cp.applied.Audience
+	s.Blanked = cp.blanked
+	web.SetState(s)
+}
+
+// Display settings from the environment
+func displayOptions(quit func()) display.Options {
+	opts := display.Options{BPP: 32, Quit: quit}
+	if s := os.Getenv("FB_BPP"); s != "" {
+		var err error
+		if opts.BPP, err = strconv.Atoi(s); err != nil {
+			log.Printf("FB_BPP %q: %v", s, err)
+			opts.BPP = 0
+		}
+	}
+	if s := os.Getenv("FB_RESOLUTION"); s != "" {
+		if _, err := fmt.Sscanf(s, "%dx%d", &opts.Width, &opts.Height); err != nil {
+			log.Printf("FB_RESOLUTION %q should be like 1920x1080: %v", s, err)
+			opts.Width, opts.Height = 0, 0
+		}
+	}
+	dither, err := drawing.ParseDither(os.Getenv("DITHER"))
 	if err != nil {
-		return err
+		log.Print(err)
 	}
+	opts.Dither = dither
+	return opts
+}
+
+// Shows the slideshow on the display described by spec, see display.Open
+func gophoto(ctx context.Context, spec string, quit func()) error {
+	log.Printf("Starting gophoto %s\n", time.Now().Format(time.RFC3339))
 
-	ConsolePicture, err := newConsolePicture(devFrameBuffer)
+	// Take over the frame buffer and cleanup afterwards
+	var cons *console.Handle
+	if display.OnConsole(spec) {
+		var err error
+		if cons, err = console.LeaseForGraphics(); err != nil {
+			return err
+		}
+		log.Printf("Got console lease %s\n", time.Now().Format(time.RFC3339))
+		defer func() {
+			// Seems to generate VT_DISALLOCATE(2): device or resource busy
+			if err := cons.Cleanup(); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+	opts := displayOptions(quit)
+	d, err := display.Open(ctx, spec, opts)
 	if err != nil {
 		return err
 	}
+	defer d.Close()
+	log.Printf("Got display %v %v %s\n", d, d.Format(), time.Now().Format(time.RFC3339))
+	web.SetStatus("Display", fmt.Sprint(d))
+	if f, ok := d.(*display.FrameBuffer); ok && f.Mode() != "" {
+		web.SetStatus("Frame buffer mode", f.Mode())
+	}
 
-	log.Printf("%s Start event loop ", time.Now().Format(time.RFC3339))
-	for {
-		if cons.Visible() {
-			if err := ConsolePicture.render(ctx); err != nil {
-				log.Printf("Failed to render %+v", err)
+	ConsolePicture, err := newConsolePicture(ctx, d)
+	if err != nil {
+		return err
+	}
+	ConsolePicture.fixed = opts.Width != 0
+	if display.OnConsole(spec) {
+		ConsolePicture.screen = monitor.Watch(ctx, monitor.DefaultRoot, os.Getenv("DISPLAY_CONNECTOR"))
+	}
+	if cfg, err := presence.FromEnv(); err != nil {
+		log.Print(err)
+	} else {
+		ConsolePicture.presence = presence.Watch(ctx, cfg)
+	}
+	if ConsolePicture.schedule, err = schedule.FromEnv(); err != nil {
+		log.Printf("Screen always on: %v", err)
+	}
+	if display.OnConsole(spec) {
+		if b, err := backlight.Find(monitor.DefaultRoot); err == nil {
+			if f, err := b.Brightness(); err != nil {
+				log.Printf("Not using the backlight: %v", err)
+			} else {
+				ConsolePicture.backlight = b
+				ConsolePicture.backlit, ConsolePicture.ownBacklit = f, f
+				web.SetStatus("Backlight", b.String())
 			}
 		}
-		log.Printf("Start sleep")
-		time.Sleep(15 * time.Second)
-		log.Printf("End sleep")
-
-		// select {
-		// case <-ctx.Done():
-		// 	// return to trigger the deferred cleanup function
-		// 	return ctx.Err()
-
-		// case <-cons.Redraw():
-		// 	break // next iteration
-		// }
-
 	}
+
+	log.Printf("%s Start event loop ", time.Now().Format(time.RFC3339))
+	ConsolePicture.run(ctx, cons)
+	return nil
 }
 
 func fatalExit(err error) {
@@ -215,16 +791,24 @@ func main() {
 			fatalExit(fmt.Errorf("recovered in f %+v", r))
 		}
 	}()
+	spec := flag.String("display", os.Getenv("DISPLAY_DEVICE"),
+		"where to show photos: fb[:/dev/fb0], drm[:/dev/dri/card0], x11, png[:frame.png] or mem")
+	flag.Parse()
+	settings.Load()
+	overrides.Load()
 	version := "GoPhoto V0.5.3"
 	log.Printf("Version %s ", version)
 	go web.StartWebServer()
-	time.Sleep(5 * time.Second) // Without a sleep the network is not up 2 secs not long enough
-	log.Printf("Finished sleep")
-	if err := enableUnprivilegedPing(); err != nil {
-		fatalExit(err)
+	if display.OnConsole(*spec) {
+		// On the frame itself wait for the network
+		time.Sleep(5 * time.Second) // Without a sleep the network is not up 2 secs not long enough
+		log.Printf("Finished sleep")
+		if err := enableUnprivilegedPing(); err != nil {
+			fatalExit(err)
+		}
+		log.Printf("Updated ping privilege %s\n", time.Now().Format(time.RFC3339))
+		pingPhotoPrism()
 	}
-	log.Printf("Updated ping privilege %s\n", time.Now().Format(time.RFC3339))
-	pingPhotoPrism()
 	log.Printf("%sa %s\n", version, time.Now().Format(time.RFC3339))
 	for _, s := range []string{"ALBUM_UID", "PHOTOPRISM_DOMAIN", "PHOTOPRISM_TOKEN"} {
 		log.Printf("Env: %s = %s\n", s, os.Getenv(s))
@@ -234,7 +818,7 @@ func main() {
 	// Cancel the context instead of exiting the program:
 	ctx, canc := signal.NotifyContext(ctx, os.Interrupt)
 	defer canc()
-	if err := gophoto(ctx); err != nil {
+	if err := gophoto(ctx, *spec, canc); err != nil {
 		fatalExit(err)
 	}
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"image"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/drummonds/gophoto/internal/control"
+	"github.com/drummonds/gophoto/internal/display"
+	"github.com/drummonds/gophoto/internal/drawing"
+	"github.com/drummonds/gophoto/internal/frame"
+	"github.com/drummonds/gophoto/internal/overrides"
+)
+
+func TestHide(t *testing.T) {
+	t.Setenv("OVERRIDES_FILE", filepath.Join(t.TempDir(), "overrides.json"))
+	overrides.Load()
+	bounds := image.Rect(0, 0, 16, 9)
+	cp := &ConsolePicture{display: display.NewMemory(bounds), pf: frame.NewPictureFrame(bounds), adjustment: drawing.NoAdjustment}
+	defer cp.pf.Close()
+	photo := func(uid string) *frame.Photo {
+		return &frame.Photo{UID: uid, Image: image.NewRGBA(image.Rect(0, 0, 4, 3))}
+	}
+	for _, uid := range []string{"a", "b", "c"} {
+		cp.addToHistory(photo(uid))
+	}
+	// Another audience saw b too, then went on to y
+	cp.histories = map[string]viewing{"guests": {[]*frame.Photo{photo("x"), photo("b"), photo("y")}, 2}}
+	uids := func(history []*frame.Photo) (uids []string) {
+		for _, p := range history {
+			uids = append(uids, p.UID)
+		}
+		return uids
+	}
+	ctx := context.Background()
+	hide := control.Command{Action: control.Hide}
+
+	cp.shown = 1 // Gone back to b
+	if err := cp.judge(ctx, hide, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(cp.history); !slices.Equal(got, []string{"a", "c"}) || cp.shown != 1 {
+		t.Errorf("history %v showing %d after hiding b, want c shown after a", got, cp.shown)
+	}
+	if v := cp.histories["guests"]; !slices.Equal(uids(v.history), []string{"x", "y"}) || v.shown != 1 {
+		t.Errorf("guests' history %v showing %d after hiding b, want y shown after x", uids(v.history), v.shown)
+	}
+
+	// Asking for it from the remote doesn't bring it back
+	cp.command(ctx, control.Command{Action: control.Show, UID: "b"}, nil)
+	if got := uids(cp.history); !slices.Equal(got, []string{"a", "c"}) || cp.shown != 1 {
+		t.Errorf("history %v showing %d after showing hidden b, want it left as it was", got, cp.shown)
+	}
+
+	// The latest goes on to a new photo, none are queued so it looks again soon
+	if err := cp.judge(ctx, hide, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(cp.history); !slices.Equal(got, []string{"a"}) || cp.retry == nil {
+		t.Errorf("history %v after hiding c, want only a and looking for another", got)
+	}
+	for _, uid := range []string{"b", "c"} {
+		if !overrides.Hidden(uid) {
+			t.Errorf("%s isn't kept hidden", uid)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package audience decides which photos who may see.  An audience is a named
+// set of rules, photos must match its include rules and not its exclude
+// rules.  The rules are checked with what a PhotoPrism search gives, so
+// nothing has to be downloaded first.
+package audience
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout of the dates in rules
+const DateLayout = "2006-01-02"
+
+// Rules match photos.  A photo matches the sources if it is in any of the
+// albums, has any of the labels or shows any of the people.
+type Rules struct {
+	Albums  []string `json:"albums,omitempty"`  // Album UIDs
+	Labels  []string `json:"labels,omitempty"`  // Label slugs
+	People  []string `json:"people,omitempty"`  // Subject UIDs
+	Private bool     `json:"private,omitempty"` // Photos marked private in PhotoPrism
+	From    string   `json:"from,omitempty"`    // Taken on or after, as 2006-01-02
+	To      string   `json:"to,omitempty"`      // Taken on or before
+}
+
+// Empty is true if there are no rules
+func (r Rules) Empty() bool {
+	return !r.hasSources() && !r.Private && r.From == "" && r.To == ""
+}
+
+func (r Rules) hasSources() bool {
+	return len(r.Albums) > 0 || len(r.Labels) > 0 || len(r.People) > 0
+}
+
+// Validate checks the dates
+func (r Rules) Validate() error {
+	from, to, err := r.dates()
+	if err != nil {
+		return err
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("%s is before %s", r.To, r.From)
+	}
+	return nil
+}
+
+// The date range, zero for an open end.  To is the end of its day.
+func (r Rules) dates() (from, to time.Time, err error) {
+	if r.From != "" {
+		if from, err = time.ParseInLocation(DateLayout, r.From, time.Local); err != nil {
+			return from, to, fmt.Errorf("from date %q should be like 2024-07-31", r.From)
+		}
+	}
+	if r.To != "" {
+		if to, err = time.ParseInLocation(DateLayout, r.To, time.Local); err != nil {
+			return from, to, fmt.Errorf("to date %q should be like 2024-07-31", r.To)
+		}
+		to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return from, to, nil
+}
+
+// Is the photo in the date range, false if there is no range
+func (r Rules) inDates(p Photo) bool {
+	from, to, _ := r.dates()
+	if from.IsZero() && to.IsZero() || p.Taken.IsZero() {
+		return false
+	}
+	return !p.Taken.Before(from) && (to.IsZero() || !p.Taken.After(to))
+}
+
+// Is the photo in any of the sources
+func (r Rules) inSources(p Photo, idx Index) bool {
+	return idx.in(idx.Albums, r.Albums, p.UID) || idx.in(idx.Labels, r.Labels, p.UID) || idx.in(idx.People, r.People, p.UID)
+}
+
+// Photo is what is known about a photo before it is fetched
+type Photo struct {
+	UID     string
+	Private bool
+	Taken   time.Time // Zero if not known
+}
+
+// Index has the photos in each album, with each label and of each person
+// that the rules mention, by source then photo UID.
+type Index struct {
+	Albums, Labels, People map[string]map[string]bool
+}
+
+func (Index) in(sets map[string]map[string]bool, sources []string, uid string) bool {
+	for _, s := range sources {
+		if sets[s][uid] {
+			return true
+		}
+	}
+	return false
+}
+
+// Audience is who is looking and what they may see
+type Audience struct {
+	Name    string `json:"name"`
+	Include Rules  `json:"include"` // Everything if empty
+	Exclude Rules  `json:"exclude"`
+}
+
+// Validate checks the audience has a name and sensible rules
+func (a Audience) Validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("audience needs a name")
+	}
+	if err := a.Include.Validate(); err != nil {
+		return fmt.Errorf("audience %s include: %v", a.Name, err)
+	}
+	if err := a.Exclude.Validate(); err != nil {
+		return fmt.Errorf("audience %s exclude: %v", a.Name, err)
+	}
+	return nil
+}
+
+// Allows is true if the audience may see the photo.  The index must have
+// the sources the rules mention, see Sources.
+func (a Audience) Allows(p Photo, idx Index) bool {
+	in := a.Include
+	if in.hasSources() && !in.inSources(p, idx) {
+		return false
+	}
+	if in.Private && !p.Private {
+		return false
+	}
+	if (in.From != "" || in.To != "") && !in.inDates(p) {
+		return false
+	}
+	out := a.Exclude
+	return !out.inSources(p, idx) && !(out.Private && p.Private) && !out.inDates(p)
+}
+
+// Sources lists all the albums, labels and people the rules mention, for
+// building the Index.
+func (a Audience) Sources() (albums, labels, people []string) {
+	albums = append(append(albums, a.Include.Albums...), a.Exclude.Albums...)
+	labels = append(append(labels, a.Include.Labels...), a.Exclude.Labels...)
+	people = append(append(people, a.Include.People...), a.Exclude.People...)
+	return albums, labels, people
+}
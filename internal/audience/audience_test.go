@@ -0,0 +1,64 @@
+package audience
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllows(t *testing.T) {
+	idx := Index{
+		Albums: map[string]map[string]bool{"family": {"pt1": true, "pt2": true, "pt3": true}},
+		Labels: map[string]map[string]bool{"beach": {"pt2": true}},
+		People: map[string]map[string]bool{"ex": {"pt3": true}},
+	}
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(DateLayout, s, time.Local)
+		return d.Add(12 * time.Hour)
+	}
+	photos := map[string]Photo{
+		"pt1": {UID: "pt1", Taken: day("2020-06-01")},
+		"pt2": {UID: "pt2", Taken: day("2023-08-31")},
+		"pt3": {UID: "pt3", Taken: day("2015-01-01")},
+		"pt4": {UID: "pt4", Private: true, Taken: day("2023-01-01")},
+		"pt5": {UID: "pt5"}, // Date unknown
+	}
+	for _, tc := range []struct {
+		audience Audience
+		want     string // Photos allowed
+	}{
+		{Audience{Name: "everyone"}, "pt1 pt2 pt3 pt4 pt5"},
+		{Audience{Name: "family", Include: Rules{Albums: []string{"family"}}, Exclude: Rules{People: []string{"ex"}}}, "pt1 pt2"},
+		{Audience{Name: "guests", Exclude: Rules{Private: true, Labels: []string{"beach"}}}, "pt1 pt3 pt5"},
+		{Audience{Name: "recent", Include: Rules{From: "2020-06-01", To: "2023-08-31"}}, "pt1 pt2 pt4"},
+		{Audience{Name: "not 2023", Exclude: Rules{From: "2023-01-01"}}, "pt1 pt3 pt5"},
+		{Audience{Name: "private", Include: Rules{Private: true}}, "pt4"},
+	} {
+		got := ""
+		for _, uid := range []string{"pt1", "pt2", "pt3", "pt4", "pt5"} {
+			if tc.audience.Allows(photos[uid], idx) {
+				if got != "" {
+					got += " "
+				}
+				got += uid
+			}
+		}
+		if got != tc.want {
+			t.Errorf("%s sees %s, want %s", tc.audience.Name, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, a := range []Audience{
+		{},
+		{Name: "bad date", Include: Rules{From: "1/2/2023"}},
+		{Name: "backwards", Exclude: Rules{From: "2023-02-01", To: "2023-01-01"}},
+	} {
+		if a.Validate() == nil {
+			t.Errorf("%+v is valid", a)
+		}
+	}
+	if err := (Audience{Name: "one day", Include: Rules{From: "2023-01-01", To: "2023-01-01"}}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package backlight dims a panel's backlight through sysfs, eg
+// /sys/class/backlight/rpi_backlight for the Raspberry Pi touchscreen.  This
+// saves power and keeps the blacks black, which dimming the pixels doesn't.
+// HDMI screens usually have no backlight here.
+package backlight
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Backlight is one under /sys/class/backlight
+type Backlight struct {
+	Dir string
+	Max int // Full brightness
+}
+
+// Find gives the first backlight under root, the sysfs mount, or an error if
+// there is none
+func Find(root string) (*Backlight, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "class/backlight/*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		max, err := readInt(filepath.Join(dir, "max_brightness"))
+		if err != nil || max <= 0 {
+			continue
+		}
+		return &Backlight{Dir: dir, Max: max}, nil
+	}
+	return nil, errors.New("no backlight")
+}
+
+func readInt(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+func (b *Backlight) String() string {
+	return fmt.Sprintf("%s of %d", filepath.Base(b.Dir), b.Max)
+}
+
+// Brightness reads it from 0 to 1
+func (b *Backlight) Brightness() (float64, error) {
+	v, err := readInt(filepath.Join(b.Dir, "brightness"))
+	if err != nil {
+		return 0, err
+	}
+	return float64(v) / float64(b.Max), nil
+}
+
+// SetBrightness sets it from 0 to 1.  It is never quite turned off, as some
+// panels then need unblanking again.
+func (b *Backlight) SetBrightness(f float64) error {
+	v := max(int(math.Round(f*float64(b.Max))), 1)
+	return os.WriteFile(filepath.Join(b.Dir, "brightness"), []byte(strconv.Itoa(min(v, b.Max))), 0644)
+}
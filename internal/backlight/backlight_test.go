@@ -0,0 +1,36 @@
+package backlight
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBacklight(t *testing.T) {
+	root := t.TempDir()
+	if _, err := Find(root); err == nil {
+		t.Error("found a backlight with none")
+	}
+	dir := filepath.Join(root, "class/backlight/rpi_backlight")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "max_brightness"), []byte("255\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "brightness"), []byte("255\n"), 0644)
+	b, err := Find(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, err := b.Brightness(); err != nil || f != 1 {
+		t.Errorf("brightness %v %v, want 1", f, err)
+	}
+	for _, c := range []struct {
+		set  float64
+		want string
+	}{{0.5, "128"}, {0, "1"}, {2, "255"}} {
+		if err := b.SetBrightness(c.set); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, "brightness")); string(got) != c.want {
+			t.Errorf("brightness %v wrote %s, want %s", c.set, got, c.want)
+		}
+	}
+}
@@ -176,8 +176,12 @@ func (h *Handle) setVisible(v bool) {
 	h.visible = v
 }
 
-// Visible returns whether this Linux console is currently visible.
+// Visible returns whether this Linux console is currently visible.  Without
+// a console, a nil Handle, the display is always visible.
 func (h *Handle) Visible() bool {
+	if h == nil {
+		return true
+	}
 	h.visibleMu.Lock()
 	defer h.visibleMu.Unlock()
 	return h.visible
@@ -187,12 +191,18 @@ func (h *Handle) Visible() bool {
 // necessary because the user switched away and then returned to this Linux
 // console.
 func (h *Handle) Redraw() <-chan struct{} {
+	if h == nil {
+		return nil
+	}
 	return h.redraw
 }
 
 // Cleanup switches the current console from graphics mode back to text mode,
 // then switches to the previous console, and finally disallocates the console.
 func (h *Handle) Cleanup() error {
+	if h == nil {
+		return nil
+	}
 	// switch back to text mode
 	if err := unix.IoctlSetInt(int(h.f.Fd()), linuxvt.KDSETMODE, linuxvt.KD_TEXT); err != nil {
 		return fmt.Errorf("KDSETMODE: %v", err)
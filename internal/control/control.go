@@ -0,0 +1,119 @@
+// Package control has the commands that steer the slideshow, whether they
+// come from a keyboard, the web remote or elsewhere.
+package control
+
+import (
+	"fmt"
+	"time"
+)
+
+// Action is something the slideshow should do now
+type Action int
+
+const (
+	Next        Action = iota + 1 // Show the next photo without waiting
+	Previous                      // Go back to the photo before
+	Pause                         // Stop changing photos
+	Resume                        // Start changing photos again
+	TogglePause                   // Pause or resume, for a single key
+	SetInterval                   // Change how long each photo is shown
+	Show                          // Show a particular photo now
+	Favourite                     // Mark or unmark the photo as a favourite
+	Like                          // Rate the photo one higher, to promote it
+	Dislike                       // Rate the photo one lower, to demote it
+	Rate                          // Give the photo a rating
+	Hide                          // Never show the photo again
+	Wake                          // Turn the screen on during its scheduled night
+)
+
+var names = map[Action]string{
+	Next: "next", Previous: "previous", Pause: "pause", Resume: "resume",
+	TogglePause: "toggle", SetInterval: "interval", Show: "show",
+	Favourite: "favourite", Like: "like", Dislike: "dislike", Rate: "rate", Hide: "hide",
+	Wake: "wake",
+}
+
+func (a Action) String() string {
+	if s, ok := names[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction reads an action from its name
+func ParseAction(s string) (Action, error) {
+	for a, name := range names {
+		if name == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown command %q, want next, previous, pause, resume, toggle, interval, show, favourite, like, dislike, rate, hide or wake", s)
+}
+
+// Command is an action with what it needs
+type Command struct {
+	Action   Action
+	Interval time.Duration // For SetInterval, or how long to Wake for with 0 the default
+	UID      string        // PhotoPrism photo for Show, or for the opinions of the photo on the screen to check it still is
+	Rating   int           // For Rate, 0 to clear
+}
+
+func (c Command) String() string {
+	switch c.Action {
+	case SetInterval:
+		return fmt.Sprintf("%v %v", c.Action, c.Interval)
+	case Wake:
+		if c.Interval != 0 {
+			return fmt.Sprintf("%v %v", c.Action, c.Interval)
+		}
+	case Show:
+		return fmt.Sprintf("%v %s", c.Action, c.UID)
+	case Rate:
+		return fmt.Sprintf("%v %d", c.Action, c.Rating)
+	}
+	return c.Action.String()
+}
+
+// Shortest time a photo can be set to show for
+const MinInterval = 5 * time.Second
+
+// Highest rating, as stars
+const MaxRating = 5
+
+// Validate checks the command has what its action needs
+func (c Command) Validate() error {
+	switch c.Action {
+	case SetInterval:
+		if c.Interval < MinInterval {
+			return fmt.Errorf("interval %v is shorter than %v", c.Interval, MinInterval)
+		}
+	case Show:
+		if c.UID == "" {
+			return fmt.Errorf("show needs a photo UID")
+		}
+	case Wake:
+		if c.Interval < 0 {
+			return fmt.Errorf("can't wake for %v", c.Interval)
+		}
+	case Rate:
+		if c.Rating < 0 || c.Rating > MaxRating {
+			return fmt.Errorf("rating %d should be from 0 to %d", c.Rating, MaxRating)
+		}
+	}
+	if _, ok := names[c.Action]; !ok {
+		return fmt.Errorf("unknown action %v", c.Action)
+	}
+	return nil
+}
+
+// State is how the slideshow is going, for showing on remotes
+type State struct {
+	Paused    bool
+	Interval  time.Duration
+	UID       string // Photo on the screen
+	Title     string
+	Favourite bool
+	Rating    int    // 0 if not rated
+	Audience  string // Who is looking, everyone if empty
+	Blanked   bool   // Screen off for the night
+}
@@ -0,0 +1,140 @@
+// Package display is where the finished frame is shown.  The slideshow
+// composites into an *image.RGBA and hands it to a Display, which converts it
+// to whatever the output needs: a Linux frame buffer or DRM card, a window on
+// an X server, PNG files or just memory for tests.
+package display
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/drummonds/gophoto/internal/control"
+	"github.com/drummonds/gophoto/internal/drawing"
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// Display shows frames
+type Display interface {
+	// Size of the frame to composite
+	Bounds() image.Rectangle
+	// Pixel format of the output, the frame is always RGBA
+	Format() fbimage.Format
+	// Show img, which has the display's bounds.  Only the damaged rectangles
+	// have changed since the last call, all of it if there are none.
+	Present(img *image.RGBA, damage ...image.Rectangle) error
+	Close() error
+}
+
+// Commander is a display that can steer the slideshow, eg from its keyboard
+type Commander interface {
+	Commands() <-chan control.Command
+}
+
+// Resizer is a display whose size can change, eg a window.  The frame needs
+// laying out again at the new size.
+type Resizer interface {
+	Resized() <-chan image.Rectangle
+}
+
+// Sizer is a display that can be asked to change resolution, eg to the native
+// one of a screen that has been plugged in.  It gives the size it ended up.
+type Sizer interface {
+	SetSize(width, height int) (image.Rectangle, error)
+}
+
+// Blanker is a display that can switch the screen off, eg at night, rather
+// than showing a black frame
+type Blanker interface {
+	Blank(blank bool) error
+}
+
+// Options for opening a display.  Not all displays use all of them.
+type Options struct {
+	Width, Height int            // Screen or window size, zero for the current or a default
+	BPP           int            // Bits per pixel to ask a frame buffer for, zero to leave it
+	Dither        drawing.Dither // For 16 bit outputs
+	Quit          func()         // Called when a window is closed
+}
+
+// Size used when there is no screen to ask
+const defaultWidth, defaultHeight = 1920, 1080
+
+// Largest width or height, X11 coordinates are 16 bit signed
+const maxSize = math.MaxInt16
+
+func (o Options) size() (image.Rectangle, error) {
+	if o.Width <= 0 || o.Height <= 0 {
+		return image.Rect(0, 0, defaultWidth, defaultHeight), nil
+	}
+	if o.Width > maxSize || o.Height > maxSize {
+		return image.Rectangle{}, fmt.Errorf("%dx%d is too big, the most is %dx%d", o.Width, o.Height, maxSize, maxSize)
+	}
+	return image.Rect(0, 0, o.Width, o.Height), nil
+}
+
+// Parse splits a display spec into its kind and argument.  It is kind:arg or
+// kind alone, a bare device path is a frame buffer or DRM card by its name.
+func Parse(spec string) (kind, arg string) {
+	switch {
+	case spec == "":
+		return "fb", ""
+	case strings.HasPrefix(spec, "/dev/dri/"):
+		return "drm", spec
+	case strings.HasPrefix(spec, "/"):
+		return "fb", spec
+	}
+	kind, arg, _ = strings.Cut(spec, ":")
+	return kind, arg
+}
+
+// OnConsole reports whether the display spec takes over the Linux console, so
+// the caller needs to lease it for graphics.  A virtual frame buffer in a
+// file doesn't.
+func OnConsole(spec string) bool {
+	kind, arg := Parse(spec)
+	return kind == "drm" || kind == "fb" && (arg == "" || strings.HasPrefix(arg, "/dev/"))
+}
+
+// Open opens the display described by spec, one of
+//
+//	fb[:/dev/fb0]           Linux frame buffer, or a virtual one if it is a file
+//	drm[:/dev/dri/card0]    DRM/KMS card, page flipped at vsync
+//	x11[:host:0]            window on the X server, $DISPLAY by default
+//	png[:frame.png]         PNG rewritten each frame, or numbered if the name has a %d
+//	mem                     in memory only
+func Open(ctx context.Context, spec string, opts Options) (Display, error) {
+	kind, arg := Parse(spec)
+	switch kind {
+	case "fb":
+		if arg == "" {
+			arg = "/dev/fb0"
+		}
+		return OpenFrameBuffer(arg, opts)
+	case "drm":
+		if arg == "" {
+			arg = "/dev/dri/card0"
+		}
+		return OpenDRM(ctx, arg, opts)
+	case "x11":
+		return OpenX11(arg, opts)
+	case "png":
+		if arg == "" {
+			arg = "frame.png"
+		}
+		size, err := opts.size()
+		if err != nil {
+			return nil, err
+		}
+		return NewPNG(arg, size), nil
+	case "mem":
+		size, err := opts.size()
+		if err != nil {
+			return nil, err
+		}
+		return NewMemory(size), nil
+	}
+	return nil, fmt.Errorf("unknown display %q, want fb, drm, x11, png or mem", spec)
+}
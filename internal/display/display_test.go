@@ -0,0 +1,131 @@
+package display
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct{ spec, kind, arg string }{
+		{"", "fb", ""},
+		{"/dev/fb1", "fb", "/dev/fb1"},
+		{"/dev/dri/card1", "drm", "/dev/dri/card1"},
+		{"x11", "x11", ""},
+		{"x11:host:0", "x11", "host:0"},
+		{"png:out/frame%04d.png", "png", "out/frame%04d.png"},
+	} {
+		kind, arg := Parse(tc.spec)
+		if kind != tc.kind || arg != tc.arg {
+			t.Errorf("Parse(%q) = %q, %q, want %q, %q", tc.spec, kind, arg, tc.kind, tc.arg)
+		}
+	}
+	if _, err := Open(context.Background(), "vga", Options{}); err == nil {
+		t.Error("opened an unknown display")
+	}
+}
+
+func TestMemoryDamage(t *testing.T) {
+	d, err := Open(context.Background(), "mem", Options{Width: 40, Height: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.(*Memory)
+	img := image.NewRGBA(d.Bounds())
+	red := color.RGBA{255, 0, 0, 255}
+	draw.Draw(img, img.Rect, &image.Uniform{red}, image.Point{}, draw.Src)
+	damage := image.Rect(10, 10, 20, 20)
+	if err := m.Present(img, damage); err != nil {
+		t.Fatal(err)
+	}
+	frame, presents, got := m.Frame()
+	if presents != 1 || len(got) != 1 || got[0] != damage {
+		t.Errorf("presents %d damage %v, want 1 and %v", presents, got, damage)
+	}
+	if c := frame.RGBAAt(15, 15); c != red {
+		t.Errorf("damaged pixel %v, want %v", c, red)
+	}
+	if c := frame.RGBAAt(5, 5); c != (color.RGBA{}) {
+		t.Errorf("undamaged pixel %v was copied", c)
+	}
+}
+
+func TestPNGSequence(t *testing.T) {
+	dir := t.TempDir()
+	d := NewPNG(filepath.Join(dir, "frame%02d.png"), image.Rect(0, 0, 8, 6))
+	img := image.NewRGBA(d.Bounds())
+	for i := 0; i < 2; i++ {
+		if err := d.Present(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"frame00.png", "frame01.png"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != 8 || cfg.Height != 6 {
+			t.Errorf("%s: %dx%d %v, want 8x6", name, cfg.Width, cfg.Height, err)
+		}
+	}
+}
+
+func TestFrameBufferFailedResize(t *testing.T) {
+	f, err := OpenFrameBuffer(filepath.Join(t.TempDir(), "fb"), Options{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img := image.NewRGBA(f.Bounds())
+	if err := f.Present(img); err != nil {
+		t.Fatal(err)
+	}
+
+	// Growing the file past the size limit fails after the old memory has
+	// been unmapped
+	signal.Ignore(syscall.SIGXFSZ)
+	defer signal.Reset(syscall.SIGXFSZ)
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_FSIZE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	small := limit
+	small.Cur = 64 << 10
+	if err := unix.Setrlimit(unix.RLIMIT_FSIZE, &small); err != nil {
+		t.Skip(err)
+	}
+	_, err = f.SetSize(1920, 1080)
+	unix.Setrlimit(unix.RLIMIT_FSIZE, &limit)
+	if err == nil {
+		t.Fatal("resized past the file size limit")
+	}
+	if err := f.Present(img); err == nil {
+		t.Error("presented to unmapped memory")
+	}
+	if b := f.Bounds(); !b.Empty() {
+		t.Errorf("bounds %v while unmapped, want none", b)
+	}
+}
+
+func TestTooBig(t *testing.T) {
+	for _, spec := range []string{"mem", "png", "x11"} {
+		if d, err := Open(context.Background(), spec, Options{Width: 40000, Height: 1080}); err == nil {
+			d.Close()
+			t.Errorf("%s opened 40000 wide, past what X11 coordinates hold", spec)
+		} else if !strings.Contains(err.Error(), "too big") {
+			t.Errorf("%s: %v, want too big", spec, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package display
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"sync"
+
+	"github.com/drummonds/gophoto/internal/drm"
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// DRM is a DRM/KMS card.  Frames are drawn on the back buffer and flipped in
+// at vsync.  When a display is plugged back in its mode is set again, and if
+// it is a different display with another native resolution the new size is
+// sent on Resized.
+type DRM struct {
+	Device  *drm.Device
+	driver  string
+	opts    Options
+	mu      sync.Mutex // Hotplug and Present both use the device
+	img     draw.Image // Nil if the display couldn't be set up again
+	blanked bool       // CRTC switched off, so nothing is flipped
+	resized chan image.Rectangle
+}
+
+// OpenDRM opens the card at path in the size given by opts if the display
+// offers it, otherwise its preferred mode.
+func OpenDRM(ctx context.Context, path string, opts Options) (*DRM, error) {
+	dev, err := drm.Open(path, opts.Width, opts.Height)
+	if err != nil {
+		return nil, err
+	}
+	img, err := dev.Image()
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	d := &DRM{Device: dev, img: img, opts: opts, resized: make(chan image.Rectangle, 1)}
+	d.driver, _ = dev.Driver()
+	hotplug, err := drm.Hotplug(ctx)
+	if err != nil {
+		log.Printf("No display hotplug events: %v", err)
+	} else {
+		go d.watch(hotplug)
+	}
+	return d, nil
+}
+
+// Sets the mode again whenever a display comes back
+func (d *DRM) watch(hotplug <-chan struct{}) {
+	for range hotplug {
+		d.mu.Lock()
+		connected, err := d.Device.Connected()
+		if err != nil {
+			log.Printf("Probing display: %v", err)
+		} else {
+			log.Printf("Display hotplug, connected %v", connected)
+			if connected && !d.blanked {
+				d.reprobe()
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Sets up whichever display is plugged in now
+func (d *DRM) reprobe() {
+	changed, err := d.Device.Reprobe(d.opts.Width, d.opts.Height)
+	if err != nil {
+		log.Printf("Setting up display again: %v", err)
+		if changed {
+			d.img = nil // The buffers have gone
+		}
+		return
+	}
+	if !changed && d.img != nil {
+		return
+	}
+	d.img, _ = d.Device.Image()
+	log.Printf("Display is now %v", d.Device.Mode)
+	select {
+	case <-d.resized: // Only the latest matters
+	default:
+	}
+	d.resized <- d.img.Bounds()
+}
+
+func (d *DRM) Bounds() image.Rectangle {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.img == nil {
+		return image.Rectangle{}
+	}
+	return d.img.Bounds()
+}
+
+func (d *DRM) Resized() <-chan image.Rectangle { return d.resized }
+func (d *DRM) Format() fbimage.Format          { return fbimage.FormatXRGB8888 }
+
+func (d *DRM) String() string {
+	return fmt.Sprintf("DRM %s (%s) %v", d.Device.Path, d.driver, d.Device.Mode)
+}
+
+// Blank switches the CRTC off, or back on for whichever display is plugged
+// in by then
+func (d *DRM) Blank(blank bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if blank == d.blanked {
+		return nil
+	}
+	if blank {
+		if err := d.Device.Blank(true); err != nil {
+			return err
+		}
+		d.blanked = true
+		return nil
+	}
+	d.blanked = false
+	d.reprobe()
+	return nil
+}
+
+// Present draws the damage on the back buffer and flips to it
+func (d *DRM) Present(img *image.RGBA, damage ...image.Rectangle) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.img == nil {
+		return fmt.Errorf("no display connected")
+	}
+	if d.blanked {
+		return nil
+	}
+	if img.Rect != d.img.Bounds() {
+		return nil // Frame for the old size, a new one is coming
+	}
+	copyRGBA(d.img, img, 0, damage...)
+	return d.Device.Flip(damage...)
+}
+
+func (d *DRM) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.Device.Close()
+}
@@ -0,0 +1,173 @@
+package display
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/drummonds/gophoto/internal/drawing"
+	"github.com/drummonds/gophoto/internal/fb"
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// FrameBuffer is a Linux fbdev device such as /dev/fb0
+type FrameBuffer struct {
+	Device *fb.Device
+	path   string
+	img    draw.Image
+	format fbimage.Format
+	dither drawing.Dither
+	mode   string // The mode change asked for at startup and how it went
+}
+
+// OpenFrameBuffer opens the frame buffer at path and asks for the bits per
+// pixel and size in opts.  Drivers that can't change mode, like vc4drmfb, are
+// used as they are.
+func OpenFrameBuffer(path string, opts Options) (*FrameBuffer, error) {
+	var dev *fb.Device
+	var err error
+	_, statErr := os.Stat(path)
+	created := os.IsNotExist(statErr) && !strings.HasPrefix(path, "/dev/")
+	if created {
+		dev, err = createVirtual(path, opts)
+	} else {
+		dev, err = fb.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var modeErr error
+	changeMode := !created && (opts.BPP != 0 || opts.Width != 0)
+	if changeMode {
+		_, modeErr = dev.SetMode(opts.BPP, opts.Width, opts.Height)
+	}
+	vinfo, err := dev.VarScreeninfo()
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	var mode string
+	if changeMode {
+		// What the driver gave and what was asked for, zeros are left as they were
+		mode = fmt.Sprintf("%dx%d %v", vinfo.Xres, vinfo.Yres, fb.Format(vinfo))
+		asked := fmt.Sprintf("asked for %dx%d %d bpp", opts.Width, opts.Height, opts.BPP)
+		if modeErr != nil {
+			log.Printf("Couldn't change frame buffer mode, using %s: %v", mode, modeErr)
+			asked += fmt.Sprintf(": %v", modeErr)
+		}
+		mode += " (" + asked + ")"
+	}
+	log.Printf("framebuffer screeninfo: %+v", vinfo)
+	img, err := dev.Image()
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return &FrameBuffer{Device: dev, path: path, img: img, format: fb.Format(vinfo), dither: opts.Dither, mode: mode}, nil
+}
+
+// Mode gives the mode obtained at startup and the one asked for, empty if
+// no change was asked for
+func (f *FrameBuffer) Mode() string { return f.mode }
+
+// A new file is made into a virtual frame buffer, so the whole slideshow can
+// run without a screen.  fbdump shows what is on it.
+func createVirtual(path string, opts Options) (*fb.Device, error) {
+	format := fbimage.FormatXRGB8888
+	switch opts.BPP {
+	case 16:
+		format = fbimage.FormatRGB565
+	case 24:
+		format = fbimage.FormatRGB888
+	}
+	size, err := opts.size()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Creating virtual frame buffer %s %dx%d %v", path, size.Dx(), size.Dy(), format)
+	return fb.CreateVirtual(path, size.Dx(), size.Dy(), format)
+}
+
+// SetSize changes the resolution keeping the bits per pixel, if the driver
+// allows it
+func (f *FrameBuffer) SetSize(width, height int) (image.Rectangle, error) {
+	_, err := f.Device.SetMode(0, width, height)
+	// The memory may have been mapped again even if it failed
+	if rerr := f.remap(); err == nil {
+		err = rerr
+	}
+	return f.Bounds(), err
+}
+
+// Makes the image on the frame buffer memory again.  It is left nil if that
+// can't be done, so nothing is drawn on memory that has been unmapped.
+func (f *FrameBuffer) remap() error {
+	f.img = nil
+	vinfo, err := f.Device.VarScreeninfo()
+	if err != nil {
+		return err
+	}
+	img, err := f.Device.Image()
+	if err != nil {
+		return err
+	}
+	f.img, f.format = img, fb.Format(vinfo)
+	return nil
+}
+
+// Bounds is empty while the frame buffer can't be drawn on
+func (f *FrameBuffer) Bounds() image.Rectangle {
+	if f.img == nil {
+		return image.Rectangle{}
+	}
+	return f.img.Bounds()
+}
+
+func (f *FrameBuffer) Format() fbimage.Format { return f.format }
+
+func (f *FrameBuffer) String() string {
+	b := f.Bounds()
+	return fmt.Sprintf("frame buffer %s %dx%d %v", f.path, b.Dx(), b.Dy(), f.format)
+}
+
+// Present copies straight into the frame buffer memory.  It isn't double
+// buffered but updates are smooth enough as mostly only overlays change.
+func (f *FrameBuffer) Present(img *image.RGBA, damage ...image.Rectangle) error {
+	if f.img == nil {
+		return errors.New("frame buffer isn't mapped since a failed mode change")
+	}
+	copyRGBA(f.img, img, f.dither, damage...)
+	return nil
+}
+
+func (f *FrameBuffer) Blank(blank bool) error {
+	return f.Device.Blank(blank)
+}
+
+func (f *FrameBuffer) Close() error {
+	return f.Device.Close()
+}
+
+// Copies src into dst using the quickest conversion for its pixel format
+func copyRGBA(dst draw.Image, src *image.RGBA, dither drawing.Dither, rects ...image.Rectangle) {
+	switch x := dst.(type) {
+	case *fbimage.BGR565:
+		drawing.CopyRGBAtoBGR565Dithered(x, src, dither, rects...)
+	case *fbimage.BGRA:
+		drawing.CopyRGBAtoBGRA(x, src, rects...)
+	case *fbimage.Packed:
+		drawing.CopyRGBAtoPacked(x, src, rects...)
+	default:
+		// Slow path, eg for grayscale
+		if len(rects) == 0 {
+			rects = []image.Rectangle{src.Rect}
+		}
+		for _, r := range rects {
+			draw.Draw(dst, r, src, r.Min, draw.Src)
+		}
+	}
+}
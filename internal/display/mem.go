@@ -0,0 +1,55 @@
+package display
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// Memory keeps the last frame in memory, for tests and headless runs
+type Memory struct {
+	mu       sync.Mutex
+	frame    *image.RGBA
+	presents int
+	damage   []image.Rectangle
+}
+
+// NewMemory makes a display of size bounds
+func NewMemory(bounds image.Rectangle) *Memory {
+	return &Memory{frame: image.NewRGBA(bounds)}
+}
+
+func (m *Memory) Bounds() image.Rectangle { return m.frame.Rect }
+
+// Format is that of an image.RGBA read as little endian words
+func (m *Memory) Format() fbimage.Format { return fbimage.FormatABGR8888 }
+
+func (m *Memory) String() string { return "memory" }
+
+func (m *Memory) Present(img *image.RGBA, damage ...image.Rectangle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.presents++
+	m.damage = append(m.damage[:0], damage...)
+	if len(damage) == 0 {
+		damage = []image.Rectangle{m.frame.Rect}
+	}
+	for _, r := range damage {
+		draw.Draw(m.frame, r, img, r.Min, draw.Src)
+	}
+	return nil
+}
+
+// Frame returns a copy of what was last presented, how many frames there
+// have been and the damage given with the last one.
+func (m *Memory) Frame() (frame *image.RGBA, presents int, damage []image.Rectangle) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	frame = image.NewRGBA(m.frame.Rect)
+	copy(frame.Pix, m.frame.Pix)
+	return frame, m.presents, append([]image.Rectangle(nil), m.damage...)
+}
+
+func (m *Memory) Close() error { return nil }
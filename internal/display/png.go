@@ -0,0 +1,56 @@
+package display
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// PNG writes each frame to a file.  If the name has a verb such as
+// frame%04d.png every frame gets its own file, otherwise the file is
+// replaced each time.
+type PNG struct {
+	Name   string
+	bounds image.Rectangle
+	count  int
+}
+
+// NewPNG makes a display of size bounds writing to name
+func NewPNG(name string, bounds image.Rectangle) *PNG {
+	return &PNG{Name: name, bounds: bounds}
+}
+
+func (p *PNG) Bounds() image.Rectangle { return p.bounds }
+func (p *PNG) Format() fbimage.Format  { return fbimage.FormatABGR8888 }
+func (p *PNG) String() string          { return "PNG " + p.Name }
+
+// Present writes the whole frame whatever the damage.  The file is written
+// under a temporary name and renamed so it is never seen half written.
+func (p *PNG) Present(img *image.RGBA, damage ...image.Rectangle) error {
+	name := p.Name
+	if strings.ContainsRune(name, '%') {
+		name = fmt.Sprintf(name, p.count)
+	}
+	p.count++
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("encoding %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (p *PNG) Close() error { return nil }
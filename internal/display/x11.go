@@ -0,0 +1,361 @@
+package display
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/shm"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/drummonds/gophoto/internal/control"
+	"github.com/drummonds/gophoto/internal/drawing"
+	"github.com/drummonds/gophoto/internal/fbimage"
+	"golang.org/x/sys/unix"
+)
+
+// Keys understood by the window, as X keysyms
+var x11Keys = map[xproto.Keysym]control.Command{
+	0xff53: {Action: control.Next},        // Right
+	0x006e: {Action: control.Next},        // n
+	0xff51: {Action: control.Previous},    // Left
+	0x0070: {Action: control.Previous},    // p
+	0x0020: {Action: control.TogglePause}, // space
+	0x0066: {Action: control.Favourite},   // f
+	0x003d: {Action: control.Like},        // = (unshifted +)
+	0x002d: {Action: control.Dislike},     // -
+	0x0068: {Action: control.Hide},        // h
+	0xffff: {Action: control.Hide},        // Delete
+}
+
+func init() {
+	// 0 to 5 rate the photo
+	for rating := 0; rating <= control.MaxRating; rating++ {
+		x11Keys[xproto.Keysym('0'+rating)] = control.Command{Action: control.Rate, Rating: rating}
+	}
+}
+
+// Keys that close the window: Escape and q
+var x11QuitKeys = map[xproto.Keysym]bool{0xff1b: true, 0x0071: true}
+
+// X11 is a window on an X server, for developing on a desktop.  Frames are
+// passed through shared memory with the MIT-SHM extension when the server is
+// on the same machine, otherwise they are sent with PutImage.  The arrow keys
+// and space steer the slideshow, f, =, -, h and the digits mark the photo as
+// a favourite, like, dislike, hide or rate it, Escape or q quits.
+type X11 struct {
+	conn       *xgb.Conn
+	window     xproto.Window
+	gc         xproto.Gcontext
+	depth      byte
+	maxRequest int  // Largest request the server takes in bytes
+	shm        bool // Using shared memory
+	keysyms    []xproto.Keysym
+	minKeycode xproto.Keycode
+	perKeycode int
+
+	commands chan control.Command
+	resized  chan image.Rectangle
+
+	mu      sync.Mutex    // Present and events both use the buffer
+	buf     *fbimage.BGRA // What the window shows in the server's format
+	seg     shm.Seg
+	shmem   []byte // Attached shared memory holding buf.Pix
+	scratch []byte // For PutImage of part of a row
+}
+
+// OpenX11 opens a window the size given by opts on the X server named by
+// display, or $DISPLAY if that is empty.  opts.Quit is called when the
+// window is closed.
+func OpenX11(display string, opts Options) (*X11, error) {
+	bounds, err := opts.size()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to X server: %v", err)
+	}
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+	if screen.RootDepth != 24 && screen.RootDepth != 32 {
+		conn.Close()
+		return nil, fmt.Errorf("X screen depth %d, only 24 and 32 are supported", screen.RootDepth)
+	}
+	x := &X11{
+		conn:       conn,
+		depth:      screen.RootDepth,
+		maxRequest: 4 * int(setup.MaximumRequestLength),
+		commands:   make(chan control.Command, 10),
+		resized:    make(chan image.Rectangle, 1),
+	}
+	if err := shm.Init(conn); err != nil {
+		log.Printf("X11 without shared memory: %v", err)
+	} else {
+		x.shm = true
+	}
+	x.readKeymap(setup)
+
+	if x.window, err = xproto.NewWindowId(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, x.window, screen.Root,
+		0, 0, uint16(bounds.Dx()), uint16(bounds.Dy()), 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwBackPixel|xproto.CwEventMask,
+		[]uint32{0, xproto.EventMaskExposure | xproto.EventMaskKeyPress | xproto.EventMaskStructureNotify}).Check()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating window: %v", err)
+	}
+	if x.gc, err = xproto.NewGcontextId(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	xproto.CreateGC(conn, x.gc, xproto.Drawable(x.window), 0, nil)
+	x.allocate(bounds)
+
+	title := "gophoto"
+	xproto.ChangeProperty(conn, xproto.PropModeReplace, x.window, xproto.AtomWmName, xproto.AtomString, 8, uint32(len(title)), []byte(title))
+	deleteWindow := x.atom("WM_DELETE_WINDOW")
+	protocols := x.atom("WM_PROTOCOLS")
+	xproto.ChangeProperty(conn, xproto.PropModeReplace, x.window, protocols, xproto.AtomAtom, 32, 1,
+		[]byte{byte(deleteWindow), byte(deleteWindow >> 8), byte(deleteWindow >> 16), byte(deleteWindow >> 24)})
+	xproto.MapWindow(conn, x.window)
+
+	go x.events(protocols, deleteWindow, opts.Quit)
+	return x, nil
+}
+
+func (x *X11) atom(name string) xproto.Atom {
+	reply, err := xproto.InternAtom(x.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		log.Printf("X11 atom %s: %v", name, err)
+		return 0
+	}
+	return reply.Atom
+}
+
+// Fetches the keyboard mapping so key presses can be turned into keysyms
+func (x *X11) readKeymap(setup *xproto.SetupInfo) {
+	x.minKeycode = setup.MinKeycode
+	reply, err := xproto.GetKeyboardMapping(x.conn, setup.MinKeycode, byte(setup.MaxKeycode-setup.MinKeycode+1)).Reply()
+	if err != nil {
+		log.Printf("X11 keyboard mapping: %v", err)
+		return
+	}
+	x.keysyms, x.perKeycode = reply.Keysyms, int(reply.KeysymsPerKeycode)
+}
+
+// The unshifted keysym of a key
+func (x *X11) keysym(code xproto.Keycode) xproto.Keysym {
+	i := int(code-x.minKeycode) * x.perKeycode
+	if code < x.minKeycode || i >= len(x.keysyms) {
+		return 0
+	}
+	return x.keysyms[i]
+}
+
+// Makes the buffer the size of the window, in shared memory if possible
+func (x *X11) allocate(bounds image.Rectangle) {
+	x.free()
+	size := 4 * bounds.Dx() * bounds.Dy()
+	x.buf = &fbimage.BGRA{Stride: 4 * bounds.Dx(), Rect: bounds}
+	if x.shm {
+		if err := x.attach(size); err != nil {
+			log.Printf("X11 without shared memory: %v", err)
+			x.shm = false
+		} else {
+			x.buf.Pix = x.shmem[:size]
+			return
+		}
+	}
+	x.buf.Pix = make([]byte, size)
+}
+
+// Creates a shared memory segment and has the server attach to it.  It is
+// marked for removal once both have it so it goes away when they do.
+func (x *X11) attach(size int) error {
+	id, err := unix.SysvShmGet(unix.IPC_PRIVATE, size, unix.IPC_CREAT|0600)
+	if err != nil {
+		return fmt.Errorf("shmget: %v", err)
+	}
+	defer unix.SysvShmCtl(id, unix.IPC_RMID, nil)
+	mem, err := unix.SysvShmAttach(id, 0, 0)
+	if err != nil {
+		return fmt.Errorf("shmat: %v", err)
+	}
+	seg, err := shm.NewSegId(x.conn)
+	if err == nil {
+		err = shm.AttachChecked(x.conn, seg, uint32(id), true).Check()
+	}
+	if err != nil {
+		unix.SysvShmDetach(mem)
+		return fmt.Errorf("attaching in the X server: %v", err)
+	}
+	x.seg, x.shmem = seg, mem
+	return nil
+}
+
+// Lets go of any shared memory
+func (x *X11) free() {
+	if x.shmem == nil {
+		return
+	}
+	shm.Detach(x.conn, x.seg)
+	x.conn.Sync()
+	unix.SysvShmDetach(x.shmem)
+	x.shmem = nil
+}
+
+// Handles window events until the connection is closed
+func (x *X11) events(protocols, deleteWindow xproto.Atom, quit func()) {
+	for {
+		ev, err := x.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("X11: %v", err)
+			continue
+		}
+		switch e := ev.(type) {
+		case xproto.ExposeEvent:
+			x.mu.Lock()
+			x.put(image.Rect(int(e.X), int(e.Y), int(e.X)+int(e.Width), int(e.Y)+int(e.Height)))
+			x.mu.Unlock()
+		case xproto.ConfigureNotifyEvent:
+			x.resize(image.Rect(0, 0, int(e.Width), int(e.Height)))
+		case xproto.KeyPressEvent:
+			sym := x.keysym(e.Detail)
+			if x11QuitKeys[sym] && quit != nil {
+				quit()
+			} else if c, ok := x11Keys[sym]; ok {
+				select {
+				case x.commands <- c:
+				default: // Too many key presses queued
+				}
+			}
+		case xproto.ClientMessageEvent:
+			if e.Type == protocols && xproto.Atom(e.Data.Data32[0]) == deleteWindow && quit != nil {
+				quit()
+			}
+		}
+	}
+}
+
+// The window has changed size, the frame needs laying out again
+func (x *X11) resize(bounds image.Rectangle) {
+	x.mu.Lock()
+	if bounds == x.buf.Rect || bounds.Empty() {
+		x.mu.Unlock()
+		return
+	}
+	x.allocate(bounds)
+	x.mu.Unlock()
+	// Only the latest size matters
+	select {
+	case <-x.resized:
+	default:
+	}
+	x.resized <- bounds
+}
+
+func (x *X11) Bounds() image.Rectangle {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.buf.Rect
+}
+
+func (x *X11) Format() fbimage.Format { return fbimage.FormatXRGB8888 }
+
+func (x *X11) String() string {
+	if x.shm {
+		return "X11 window with shared memory"
+	}
+	return "X11 window"
+}
+
+// Commands from the keyboard
+func (x *X11) Commands() <-chan control.Command { return x.commands }
+
+// Resized gives the new size whenever the window changes size
+func (x *X11) Resized() <-chan image.Rectangle { return x.resized }
+
+// Present shows the damage in the window.  A frame of the wrong size, drawn
+// before a resize was noticed, is skipped.
+func (x *X11) Present(img *image.RGBA, damage ...image.Rectangle) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if img.Rect != x.buf.Rect {
+		return nil
+	}
+	drawing.CopyRGBAtoBGRA(x.buf, img, damage...)
+	if len(damage) == 0 {
+		damage = []image.Rectangle{x.buf.Rect}
+	}
+	for _, r := range damage {
+		x.put(r)
+	}
+	return nil
+}
+
+// Sends a rectangle of the buffer to the window and waits for the server to
+// have it, so the buffer can be changed again.
+func (x *X11) put(r image.Rectangle) {
+	r = r.Intersect(x.buf.Rect)
+	if r.Empty() {
+		return
+	}
+	if x.shm {
+		shm.PutImage(x.conn, xproto.Drawable(x.window), x.gc,
+			uint16(x.buf.Rect.Dx()), uint16(x.buf.Rect.Dy()),
+			uint16(r.Min.X), uint16(r.Min.Y), uint16(r.Dx()), uint16(r.Dy()),
+			int16(r.Min.X), int16(r.Min.Y), x.depth, xproto.ImageFormatZPixmap, 0, x.seg, 0)
+	} else {
+		x.putChunked(r)
+	}
+	x.conn.Sync()
+}
+
+// Sends the rectangle with as many rows in each PutImage as fit in a request
+func (x *X11) putChunked(r image.Rectangle) {
+	const putImageHeader = 24
+	rowBytes := 4 * r.Dx()
+	rows := (x.maxRequest - putImageHeader) / rowBytes
+	if rows < 1 {
+		rows = 1 // Only if the window is absurdly wide
+	}
+	whole := r.Min.X == x.buf.Rect.Min.X && r.Max.X == x.buf.Rect.Max.X
+	for y := r.Min.Y; y < r.Max.Y; y += rows {
+		n := min(rows, r.Max.Y-y)
+		var data []byte
+		if whole {
+			// Full width rows are already next to each other
+			from := x.buf.PixOffset(r.Min.X, y)
+			data = x.buf.Pix[from : from+n*rowBytes]
+		} else {
+			if cap(x.scratch) < n*rowBytes {
+				x.scratch = make([]byte, n*rowBytes)
+			}
+			data = x.scratch[:n*rowBytes]
+			for i := 0; i < n; i++ {
+				from := x.buf.PixOffset(r.Min.X, y+i)
+				copy(data[i*rowBytes:], x.buf.Pix[from:from+rowBytes])
+			}
+		}
+		xproto.PutImage(x.conn, xproto.ImageFormatZPixmap, xproto.Drawable(x.window), x.gc,
+			uint16(r.Dx()), uint16(n), int16(r.Min.X), int16(y), 0, x.depth, data)
+	}
+}
+
+func (x *X11) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.free()
+	xproto.DestroyWindow(x.conn, x.window)
+	x.conn.Close()
+	return nil
+}
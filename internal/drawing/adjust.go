@@ -0,0 +1,85 @@
+package drawing
+
+import (
+	"image"
+	"math"
+)
+
+// Adjustment changes the colours of the frame just before it goes to the
+// screen, to suit the room rather than the photo
+type Adjustment struct {
+	Brightness float64 // 1 leaves it, 0 is black
+	Contrast   float64 // About mid grey, 1 leaves it
+	Gamma      float64 // 1 leaves it, more lifts the shadows
+	Kelvin     float64 // Colour temperature of white, 6500 leaves it and less is warmer
+}
+
+// NoAdjustment leaves the colours as they are
+var NoAdjustment = Adjustment{Brightness: 1, Contrast: 1, Gamma: 1, Kelvin: 6500}
+
+// LUT is a lookup table for each of red, green and blue
+type LUT [3][256]uint8
+
+// LUT makes the table for the adjustment, nil if it changes nothing
+func (a Adjustment) LUT() *LUT {
+	if a == NoAdjustment {
+		return nil
+	}
+	white := KelvinRGB(a.Kelvin)
+	lut := new(LUT)
+	for i := range 256 {
+		v := math.Pow(float64(i)/255, 1/a.Gamma)
+		v = ((v-0.5)*a.Contrast + 0.5) * a.Brightness
+		for c := range lut {
+			lut[c][i] = uint8(math.Round(min(max(v*white[c], 0), 1) * 255))
+		}
+	}
+	return lut
+}
+
+// Apply puts src through the table into dst, only the rects given if there
+// are any.  The frame is opaque so alpha is copied as it is.
+func (l *LUT) Apply(dst, src *image.RGBA, rects ...image.Rectangle) {
+	for _, r := range copyRects(dst.Rect, src, rects) {
+		parallelRows(r, func(band image.Rectangle) {
+			for y := band.Min.Y; y < band.Max.Y; y++ {
+				s := src.Pix[src.PixOffset(band.Min.X, y):src.PixOffset(band.Max.X, y)]
+				d := dst.Pix[dst.PixOffset(band.Min.X, y):dst.PixOffset(band.Max.X, y)]
+				for i := 0; i+3 < len(s); i += 4 {
+					d[i] = l[0][s[i]]
+					d[i+1] = l[1][s[i+1]]
+					d[i+2] = l[2][s[i+2]]
+					d[i+3] = s[i+3]
+				}
+			}
+		})
+	}
+}
+
+// KelvinRGB is the colour of white at a colour temperature from 1000K to
+// 40000K, as a multiplier for each of red, green and blue with 6500K white.
+// It is Tanner Helland's fit to the black body colours.
+func KelvinRGB(kelvin float64) [3]float64 {
+	rgb := func(k float64) [3]float64 {
+		t := min(max(k, 1000), 40000) / 100
+		var r, g, b float64
+		if t <= 66 {
+			r = 255
+			g = 99.4708025861*math.Log(t) - 161.1195681661
+		} else {
+			r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+			g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+		}
+		switch {
+		case t >= 66:
+			b = 255
+		case t <= 19:
+			b = 0
+		default:
+			b = 138.5177312231*math.Log(t-10) - 305.0447927307
+		}
+		return [3]float64{min(max(r, 0), 255), min(max(g, 0), 255), min(max(b, 0), 255)}
+	}
+	c, white := rgb(kelvin), rgb(6500)
+	return [3]float64{c[0] / white[0], c[1] / white[1], c[2] / white[2]}
+}
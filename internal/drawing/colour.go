@@ -0,0 +1,88 @@
+package drawing
+
+import (
+	"image"
+	"image/color"
+)
+
+// Maximum number of samples taken along each axis when estimating the colour
+// of an image.  A 4K photo has 8M pixels which is far more than needed.
+const colourSamples = 64
+
+// sampleStep returns the step between samples so that roughly colourSamples
+// are taken across n pixels.
+func sampleStep(n int) int {
+	step := n / colourSamples
+	if step < 1 {
+		step = 1
+	}
+	return step
+}
+
+// AverageColour returns the mean colour of the part of img inside r.
+// The image is sampled on a coarse grid so this is cheap even for large
+// photos.
+func AverageColour(img image.Image, r image.Rectangle) color.RGBA {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return color.RGBA{A: 0xff}
+	}
+	var sr, sg, sb, n uint64
+	stepX, stepY := sampleStep(r.Dx()), sampleStep(r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y += stepY {
+		for x := r.Min.X; x < r.Max.X; x += stepX {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			sr += uint64(cr >> 8)
+			sg += uint64(cg >> 8)
+			sb += uint64(cb >> 8)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(sr / n), G: uint8(sg / n), B: uint8(sb / n), A: 0xff}
+}
+
+// DominantColour returns the most common colour of img.  Colours are
+// bucketed to 4 bits per channel and the average of the fullest bucket is
+// returned, so small variations in a sky or wall still count as one colour.
+func DominantColour(img image.Image) color.RGBA {
+	type bucket struct {
+		r, g, b, n uint64
+	}
+	buckets := make(map[uint16]*bucket)
+	var best *bucket
+	bounds := img.Bounds()
+	stepX, stepY := sampleStep(bounds.Dx()), sampleStep(bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			key := uint16(cr>>12)<<8 | uint16(cg>>12)<<4 | uint16(cb>>12)
+			b, ok := buckets[key]
+			if !ok {
+				b = new(bucket)
+				buckets[key] = b
+			}
+			b.r += uint64(cr >> 8)
+			b.g += uint64(cg >> 8)
+			b.b += uint64(cb >> 8)
+			b.n++
+			if best == nil || b.n > best.n {
+				best = b
+			}
+		}
+	}
+	if best == nil {
+		return color.RGBA{A: 0xff}
+	}
+	return color.RGBA{R: uint8(best.r / best.n), G: uint8(best.g / best.n), B: uint8(best.b / best.n), A: 0xff}
+}
+
+// Darken scales the colour towards black, factor 0 gives black and 1 leaves
+// the colour unchanged.
+func Darken(c color.RGBA, factor float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(float64(c.R) * factor),
+		G: uint8(float64(c.G) * factor),
+		B: uint8(float64(c.B) * factor),
+		A: c.A,
+	}
+}
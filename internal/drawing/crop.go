@@ -0,0 +1,160 @@
+package drawing
+
+import (
+	"image"
+	"math"
+)
+
+// Longest side of the thumbnail used to estimate where the interesting part
+// of a photo is.
+const saliencySize = 128
+
+// How much less detail at the very edge of a photo counts compared to the
+// centre.
+const centreBias = 0.5
+
+// CropSize returns the size of the largest rectangle with the aspect ratio of
+// target that fits inside a source of size src.
+func CropSize(src, target image.Point) image.Point {
+	if target.X <= 0 || target.Y <= 0 || src.X <= 0 || src.Y <= 0 {
+		return src
+	}
+	if src.X*target.Y > src.Y*target.X {
+		// Source is wider than the target, keep the full height
+		return image.Point{src.Y * target.X / target.Y, src.Y}
+	}
+	return image.Point{src.X, src.X * target.Y / target.X}
+}
+
+// CropFraction returns how much of src is thrown away by cropping it to crop,
+// 0 is nothing and 1 is everything.
+func CropFraction(src, crop image.Rectangle) float64 {
+	srcArea := src.Dx() * src.Dy()
+	if srcArea == 0 {
+		return 0
+	}
+	crop = crop.Intersect(src)
+	return 1 - float64(crop.Dx()*crop.Dy())/float64(srcArea)
+}
+
+// CropWindow returns the largest rectangle inside src with the aspect ratio of
+// target, positioned to keep interest in view.  If interest is larger than
+// the window then horizontally it is kept centred and vertically the top is
+// kept, as that is where the heads are.
+func CropWindow(src image.Rectangle, target image.Point, interest image.Rectangle) image.Rectangle {
+	size := CropSize(src.Size(), target)
+	interest = interest.Intersect(src)
+	if interest.Empty() {
+		interest = image.Rectangle{src.Min, src.Min}.Add(src.Size().Div(2))
+	}
+	x := place(src.Min.X, src.Max.X, size.X, interest.Min.X, interest.Max.X, false)
+	y := place(src.Min.Y, src.Max.Y, size.Y, interest.Min.Y, interest.Max.Y, true)
+	return image.Rect(x, y, x+size.X, y+size.Y)
+}
+
+// place positions a window of length n inside [lo, hi) so that it covers
+// [from, to) as well as it can and returns the start of the window.
+func place(lo, hi, n, from, to int, keepStart bool) int {
+	var start int
+	if to-from > n && keepStart {
+		start = from
+	} else {
+		start = (from+to)/2 - n/2
+	}
+	if start+n > hi {
+		start = hi - n
+	}
+	if start < lo {
+		start = lo
+	}
+	return start
+}
+
+// SalientCrop returns the window inside img with the aspect ratio of target
+// that contains the most detail.  Detail is measured as the edge energy of a
+// small greyscale copy of the photo, which is a cheap stand in for saliency:
+// faces, people and objects are busier than sky, walls and out of focus
+// backgrounds.
+func SalientCrop(img image.Image, target image.Point) image.Rectangle {
+	src := img.Bounds()
+	size := CropSize(src.Size(), target)
+	horizontal := size.X < src.Dx()
+	if size == src.Size() {
+		return src
+	}
+
+	// Greyscale thumbnail by point sampling
+	step := max(src.Dx(), src.Dy())/saliencySize + 1
+	w, h := src.Dx()/step, src.Dy()/step
+	if w < 3 || h < 3 {
+		return CropWindow(src, target, image.Rectangle{})
+	}
+	grey := make([]int32, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(src.Min.X+x*step, src.Min.Y+y*step).RGBA()
+			grey[y*w+x] = int32((299*r + 587*g + 114*b) / 1000 >> 8)
+		}
+	}
+
+	// Sum the edge energy of each column or row along the free axis
+	n := h
+	if horizontal {
+		n = w
+	}
+	energy := make([]int64, n+1) // prefix sums
+	line := make([]int64, n)
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			e := abs32(grey[i+1]-grey[i-1]) + abs32(grey[i+w]-grey[i-w])
+			if horizontal {
+				line[x] += int64(e)
+			} else {
+				line[y] += int64(e)
+			}
+		}
+	}
+	// Weight towards the middle as photographers usually frame the subject
+	// there, this stops foliage and brickwork at the edges winning.
+	half := float64(n) / 2
+	for i, e := range line {
+		weight := 1 - centreBias*math.Abs(float64(i)+0.5-half)/half
+		energy[i+1] = energy[i] + int64(float64(e)*weight)
+	}
+
+	// Slide the window along and keep the best, ties go to the most central
+	windowLen := size.Y * n / src.Dy()
+	if horizontal {
+		windowLen = size.X * n / src.Dx()
+	}
+	best, bestStart := int64(-1), 0
+	centre := (n - windowLen) / 2
+	for start := 0; start+windowLen <= n; start++ {
+		e := energy[start+windowLen] - energy[start]
+		if e > best || (e == best && abs(start-centre) < abs(bestStart-centre)) {
+			best, bestStart = e, start
+		}
+	}
+
+	if horizontal {
+		x := min(src.Min.X+bestStart*step, src.Max.X-size.X)
+		return image.Rect(x, src.Min.Y, x+size.X, src.Min.Y+size.Y)
+	}
+	y := min(src.Min.Y+bestStart*step, src.Max.Y-size.Y)
+	return image.Rect(src.Min.X, y, src.Min.X+size.X, y+size.Y)
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,138 @@
+package drawing
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// Dither is how colours are spread when converting to 16 bit, to avoid
+// banding in skies and skin.
+type Dither int
+
+const (
+	DitherNone      Dither = iota // Truncate, the quickest
+	DitherOrdered                 // Bayer matrix, cheap and stable between frames
+	DitherDiffusion               // Floyd-Steinberg, the smoothest but runs on one core
+)
+
+func (d Dither) String() string {
+	switch d {
+	case DitherOrdered:
+		return "ordered"
+	case DitherDiffusion:
+		return "diffusion"
+	}
+	return "none"
+}
+
+// ParseDither reads a dither setting, empty is none
+func ParseDither(s string) (Dither, error) {
+	switch s {
+	case "", "none":
+		return DitherNone, nil
+	case "ordered", "bayer":
+		return DitherOrdered, nil
+	case "diffusion", "floyd-steinberg":
+		return DitherDiffusion, nil
+	}
+	return DitherNone, fmt.Errorf("unknown dither %q, should be none, ordered or diffusion", s)
+}
+
+// 8x8 Bayer threshold matrix with values 0 to 63
+var bayer8 = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// CopyRGBAtoBGR565Dithered is CopyRGBAtoBGR565 with dithering.  Ordered
+// dithering uses the screen position so redrawing part of the screen matches
+// the rest.  Error diffusion can only run one rectangle at a time.
+func CopyRGBAtoBGR565Dithered(dst *fbimage.BGR565, src *image.RGBA, dither Dither, rects ...image.Rectangle) {
+	switch dither {
+	case DitherOrdered:
+		for _, r := range copyRects(dst.Bounds(), src, rects) {
+			parallelRows(r, func(band image.Rectangle) { copyRGBAtoBGR565Ordered(dst, src, band) })
+		}
+	case DitherDiffusion:
+		for _, r := range copyRects(dst.Bounds(), src, rects) {
+			copyRGBAtoBGR565Diffused(dst, src, r)
+		}
+	default:
+		CopyRGBAtoBGR565(dst, src, rects...)
+	}
+}
+
+// Straight colour of a premultiplied pixel, as the fast path does
+func unpremultiply(s []byte) (r, g, b int) {
+	switch a := int(s[3]); a {
+	case 0xff:
+		return int(s[0]), int(s[1]), int(s[2])
+	case 0:
+		return 0, 0, 0
+	default:
+		return int(s[0]) * 0xff / a, int(s[1]) * 0xff / a, int(s[2]) * 0xff / a
+	}
+}
+
+func put565(pix []byte, r, g, b int) {
+	pix[0] = byte(b>>3) | byte(g>>2)<<5
+	pix[1] = byte(g>>5) | byte(r>>3)<<3
+}
+
+func copyRGBAtoBGR565Ordered(dst *fbimage.BGR565, src *image.RGBA, rect image.Rectangle) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := &bayer8[y&7]
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := src.PixOffset(x, y)
+			r, g, b := unpremultiply(src.Pix[i : i+4 : i+4])
+			// Spread the threshold over the step that is lost, 8 for 5 bits and
+			// 4 for 6 bits, so the average comes out right.
+			t := int(row[x&7])
+			r = min(r+t/8, 0xff)
+			g = min(g+t/16, 0xff)
+			b = min(b+t/8, 0xff)
+			put565(dst.Pix[dst.PixOffset(x, y):], r, g, b)
+		}
+	}
+}
+
+// Floyd-Steinberg, pushing the error of each pixel onto its neighbours to the
+// right and below.
+func copyRGBAtoBGR565Diffused(dst *fbimage.BGR565, src *image.RGBA, rect image.Rectangle) {
+	w := rect.Dx()
+	// Errors for this row and the next, in 1/16ths, with a pixel spare each end
+	cur := make([]int32, 3*(w+2))
+	next := make([]int32, 3*(w+2))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := src.PixOffset(x, y)
+			r, g, b := unpremultiply(src.Pix[i : i+4 : i+4])
+			e := 3 * (x - rect.Min.X + 1)
+			r = clamp(r + int(cur[e]/16))
+			g = clamp(g + int(cur[e+1]/16))
+			b = clamp(b + int(cur[e+2]/16))
+			put565(dst.Pix[dst.PixOffset(x, y):], r, g, b)
+			// What was lost is what the display can't show
+			for c, err := range [3]int32{int32(r & 7), int32(g & 3), int32(b & 7)} {
+				cur[e+3+c] += err * 7
+				next[e-3+c] += err * 3
+				next[e+c] += err * 5
+				next[e+3+c] += err
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+}
+
+func clamp(v int) int {
+	return max(0, min(v, 0xff))
+}
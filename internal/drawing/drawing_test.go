@@ -2,7 +2,11 @@ package drawing
 
 import (
 	"image"
+	"image/color"
+	"image/draw"
 	"testing"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
 )
 
 // TestHelloName calls greetings.Hello with a name, checking
@@ -24,3 +28,144 @@ func TestScaleImageOuterWider(t *testing.T) {
 		t.Fatalf(`ScaleImageOuter result = %v, want %v`, result, want)
 	}
 }
+
+func TestAverageColour(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, image.Rect(0, 0, 50, 100), &image.Uniform{color.RGBA{R: 200, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(50, 0, 100, 100), &image.Uniform{color.RGBA{B: 100, A: 255}}, image.Point{}, draw.Src)
+	result := AverageColour(img, img.Bounds())
+	want := color.RGBA{R: 100, B: 50, A: 255}
+	if result != want {
+		t.Fatalf(`AverageColour result = %v, want %v`, result, want)
+	}
+	// Only the left half
+	result = AverageColour(img, image.Rect(0, 0, 50, 100))
+	want = color.RGBA{R: 200, A: 255}
+	if result != want {
+		t.Fatalf(`AverageColour left result = %v, want %v`, result, want)
+	}
+}
+
+func TestDominantColour(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{G: 180, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 30, 100), &image.Uniform{color.RGBA{R: 250, A: 255}}, image.Point{}, draw.Src)
+	result := DominantColour(img)
+	want := color.RGBA{G: 180, A: 255}
+	if result != want {
+		t.Fatalf(`DominantColour result = %v, want %v`, result, want)
+	}
+}
+
+func TestCropWindowKeepsFace(t *testing.T) {
+	// Portrait photo shown on a landscape screen, face near the top
+	src := image.Rect(0, 0, 1000, 1500)
+	face := image.Rect(400, 100, 600, 300)
+	result := CropWindow(src, image.Point{1920, 1080}, face)
+	if !face.In(result) {
+		t.Fatalf(`CropWindow result = %v does not contain face %v`, result, face)
+	}
+	if result.Dx() != 1000 || result.Dy() != 562 {
+		t.Fatalf(`CropWindow result = %v, want 1000x562`, result)
+	}
+}
+
+func TestSalientCrop(t *testing.T) {
+	// Plain image with a busy patch on the right
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{R: 80, G: 80, B: 80, A: 255}}, image.Point{}, draw.Src)
+	for y := 0; y < 100; y += 4 {
+		draw.Draw(img, image.Rect(300, y, 380, y+2), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	}
+	result := SalientCrop(img, image.Point{100, 100})
+	if result.Size() != (image.Point{100, 100}) || result.Min.X < 280 {
+		t.Fatalf(`SalientCrop result = %v, want 100x100 window over the detail at 300-380`, result)
+	}
+}
+
+func TestCopyRects(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(src, src.Bounds(), &image.Uniform{color.RGBA{0x10, 0x20, 0x30, 0xff}}, image.Point{}, draw.Src)
+	// Padded stride like many frame buffers
+	dst := &fbimage.BGRA{Pix: make([]byte, 40*8), Rect: src.Bounds(), Stride: 40}
+	CopyRGBAtoBGRA(dst, src, image.Rect(2, 2, 4, 4))
+	if got := dst.At(2, 3); got != (color.RGBA{0x10, 0x20, 0x30, 0xff}) {
+		t.Errorf("Inside damage got %v", got)
+	}
+	if got := dst.At(4, 3); got != (color.RGBA{}) {
+		t.Errorf("Outside damage should not be copied, got %v", got)
+	}
+}
+
+func TestCopyRGBAtoPacked(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	c := color.RGBA{0xf0, 0x80, 0x10, 0xff}
+	draw.Draw(src, src.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	for _, f := range []fbimage.Format{
+		fbimage.FormatRGB565, fbimage.FormatBGR565, fbimage.FormatRGB888, fbimage.FormatBGR888,
+		fbimage.FormatXRGB8888, fbimage.FormatRGBA8888, fbimage.FormatABGR8888,
+		{BitsPerPixel: 16, Red: fbimage.Field{Offset: 10, Length: 5}, Green: fbimage.Field{Offset: 5, Length: 5},
+			Blue: fbimage.Field{Length: 5}, Trans: fbimage.Field{Offset: 15, Length: 1}}, // ARGB1555, generic
+	} {
+		dst := &fbimage.Packed{Pix: make([]byte, 4*2*4), Rect: src.Bounds(), Stride: 4 * 4, Format: f}
+		CopyRGBAtoPacked(dst, src)
+		got := dst.At(3, 1).(color.RGBA)
+		if want := f.Unpack(f.Pack(c)); got != want || !(got.R > got.G && got.G > got.B) {
+			t.Errorf("%v: got %v, want %v", f, got, want)
+		}
+	}
+}
+
+// A flat colour between two 565 levels should average out right when dithered
+func TestDither(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	c := color.RGBA{0x84, 0x42, 0x1c, 0xff}
+	draw.Draw(src, src.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	for _, d := range []Dither{DitherOrdered, DitherDiffusion} {
+		dst := &fbimage.BGR565{Pix: make([]byte, 2*64*64), Rect: src.Bounds(), Stride: 2 * 64}
+		CopyRGBAtoBGR565Dithered(dst, src, d)
+		var sr, sg, sb int
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				// Levels as stored, without the replication At does
+				p := dst.Pix[dst.PixOffset(x, y):]
+				sr += int(p[1]>>3) << 3
+				sg += int(p[1]<<5|(p[0]>>5)<<2) & 0xfc
+				sb += int(p[0]&0x1f) << 3
+			}
+		}
+		n := 64 * 64
+		for i, got := range []int{sr / n, sg / n, sb / n} {
+			want := []int{int(c.R), int(c.G), int(c.B)}[i]
+			if got < want-1 || got > want+1 {
+				t.Errorf("%v channel %d averages %d, want %d", d, i, got, want)
+			}
+		}
+	}
+}
+
+func TestAdjustment(t *testing.T) {
+	if NoAdjustment.LUT() != nil {
+		t.Error("no adjustment has a table")
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(src, src.Bounds(), &image.Uniform{color.RGBA{0x80, 0x80, 0x80, 0xff}}, image.Point{}, draw.Src)
+	dst := image.NewRGBA(src.Rect)
+
+	dim := NoAdjustment
+	dim.Brightness = 0.5
+	dim.LUT().Apply(dst, src, image.Rect(0, 0, 2, 4))
+	if got := dst.RGBAAt(1, 1); got != (color.RGBA{0x40, 0x40, 0x40, 0xff}) {
+		t.Errorf("half brightness gave %v", got)
+	}
+	if got := dst.RGBAAt(2, 1); got != (color.RGBA{}) {
+		t.Errorf("outside the damage got %v", got)
+	}
+
+	warm := NoAdjustment
+	warm.Kelvin = 3000
+	warm.LUT().Apply(dst, src)
+	if got := dst.RGBAAt(3, 3); got.R != 0x80 || !(got.G < got.R && got.B < got.G) {
+		t.Errorf("warm grey is %v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package drawing
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+// CopyRGBAtoPacked copies to a frame buffer of any pixel format.  Formats
+// with whole byte channels (24 and 32 bits) and 16 bit formats have quick
+// paths, anything else is packed pixel by pixel.  Only the rects given are
+// copied, or everything if there are none.
+func CopyRGBAtoPacked(dst *fbimage.Packed, src *image.RGBA, rects ...image.Rectangle) {
+	copyBand := copyPackedGeneric
+	if r, g, b, a, ok := dst.Format.ByteAligned(); ok {
+		copyBand = func(dst *fbimage.Packed, src *image.RGBA, rect image.Rectangle) {
+			copyPackedBytes(dst, src, rect, r, g, b, a)
+		}
+	} else if dst.Format.BitsPerPixel == 16 && dst.Format.Trans.Length == 0 {
+		copyBand = copyPacked16
+	}
+	for _, r := range copyRects(dst.Bounds(), src, rects) {
+		parallelRows(r, func(band image.Rectangle) { copyBand(dst, src, band) })
+	}
+}
+
+// Shuffles the bytes, a is -1 if there is no alpha.  Any padding byte is
+// left alone.
+func copyPackedBytes(dst *fbimage.Packed, src *image.RGBA, rect image.Rectangle, r, g, b, a int) {
+	bpp := dst.Format.BytesPerPixel()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		sp := src.Pix[src.PixOffset(rect.Min.X, y):src.PixOffset(rect.Max.X, y)]
+		dp := dst.Pix[dst.PixOffset(rect.Min.X, y):]
+		for i, j := 0, 0; i < len(sp); i, j = i+4, j+bpp {
+			s := sp[i : i+4 : i+4]
+			d := dp[j : j+bpp : j+bpp]
+			d[r], d[g], d[b] = s[0], s[1], s[2]
+			if a >= 0 {
+				d[a] = s[3]
+			}
+		}
+	}
+}
+
+// Packs 16 bit pixels with the shifts worked out once
+func copyPacked16(dst *fbimage.Packed, src *image.RGBA, rect image.Rectangle) {
+	f := dst.Format
+	rs, gs, bs := 8-f.Red.Length, 8-f.Green.Length, 8-f.Blue.Length
+	ro, gO, bo := f.Red.Offset, f.Green.Offset, f.Blue.Offset
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		sp := src.Pix[src.PixOffset(rect.Min.X, y):src.PixOffset(rect.Max.X, y)]
+		dp := dst.Pix[dst.PixOffset(rect.Min.X, y):]
+		for i, j := 0, 0; i < len(sp); i, j = i+4, j+2 {
+			s := sp[i : i+4 : i+4]
+			p := uint16(s[0]>>rs)<<ro | uint16(s[1]>>gs)<<gO | uint16(s[2]>>bs)<<bo
+			dp[j], dp[j+1] = byte(p), byte(p>>8)
+		}
+	}
+}
+
+func copyPackedGeneric(dst *fbimage.Packed, src *image.RGBA, rect image.Rectangle) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			s := src.Pix[src.PixOffset(x, y):]
+			dst.SetPixel(dst.PixOffset(x, y), dst.Format.Pack(color.RGBA{s[0], s[1], s[2], s[3]}))
+		}
+	}
+}
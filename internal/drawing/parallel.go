@@ -0,0 +1,34 @@
+package drawing
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// Workers is how many bands of rows conversions and scaling are split into
+// to run in parallel.  1 runs everything on the calling goroutine.
+var Workers = runtime.NumCPU()
+
+// Bands smaller than this aren't worth a goroutine
+const minBandRows = 32
+
+// Calls fn for bands of rows of r, in parallel.  Each band is independent so
+// the result is the same however it is split.
+func parallelRows(r image.Rectangle, fn func(band image.Rectangle)) {
+	n := min(Workers, r.Dy()/minBandRows)
+	if n <= 1 {
+		fn(r)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		band := image.Rect(r.Min.X, r.Min.Y+r.Dy()*i/n, r.Max.X, r.Min.Y+r.Dy()*(i+1)/n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(band)
+		}()
+	}
+	wg.Wait()
+}
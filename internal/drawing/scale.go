@@ -0,0 +1,158 @@
+package drawing
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Filter taps for one output pixel, the weights apply to consecutive source
+// pixels starting at first.  They aren't normalised, the sum is divided out
+// afterwards as x/image does.
+type taps struct {
+	first int
+	w     []float64
+	inv   float64 // 1 / the sum of w
+}
+
+// Scale resamples sr of src into dr of dst with a Catmull-Rom filter, drawing
+// over what is already there.  It is done in two passes, across then down,
+// in strips of stripRows rows so only the source rows a strip needs are held
+// scaled across.  Bands of strips are run by Workers goroutines and the
+// result doesn't depend on the number of workers.
+//
+// The result is exactly that of x/image's draw.CatmullRom.Scale with
+// draw.Over, which it replaces: the arithmetic is done the same way and in
+// the same order.  Products are converted to float64 so they aren't fused
+// into multiply-adds, which would round differently on arm64.
+func Scale(dst *image.RGBA, dr image.Rectangle, src image.Image, sr image.Rectangle) {
+	clip := dr.Intersect(dst.Bounds())
+	sr = sr.Intersect(src.Bounds())
+	if clip.Empty() || sr.Empty() {
+		return
+	}
+	s, ok := src.(*image.RGBA)
+	if !ok {
+		s = image.NewRGBA(sr)
+		draw.Draw(s, sr, src, sr.Min, draw.Src)
+	}
+	xTaps := filterTaps(dr.Dx(), sr.Dx(), sr.Min.X)
+	yTaps := filterTaps(dr.Dy(), sr.Dy(), sr.Min.Y)
+	cols := clip.Sub(dr.Min) // Columns of dr that are in dst, only they are scaled
+	tmpW := cols.Dx()
+
+	parallelRows(clip, func(band image.Rectangle) {
+		var tmp []float64
+		for top := band.Min.Y; top < band.Max.Y; top += stripRows {
+			bottom := min(top+stripRows, band.Max.Y)
+			// Taps move down the source with the rows, so the strip needs
+			// from the first tap of its top row to the last of its bottom
+			first := yTaps[top-dr.Min.Y].first
+			last := yTaps[bottom-1-dr.Min.Y]
+			n := last.first + len(last.w) - first
+			if cap(tmp) < 4*tmpW*n {
+				tmp = make([]float64, 4*tmpW*n)
+			}
+
+			// Across: the source rows into tmp, in 16 bits a channel
+			for y := first; y < first+n; y++ {
+				t := tmp[4*tmpW*(y-first):]
+				for x := 0; x < tmpW; x++ {
+					tap := xTaps[cols.Min.X+x]
+					p := s.Pix[s.PixOffset(tap.first, y):]
+					var r, g, b, a float64
+					for i, w := range tap.w {
+						q := p[4*i : 4*i+4 : 4*i+4]
+						r += float64(float64(uint32(q[0])*0x101) * w)
+						g += float64(float64(uint32(q[1])*0x101) * w)
+						b += float64(float64(uint32(q[2])*0x101) * w)
+						a += float64(float64(uint32(q[3])*0x101) * w)
+					}
+					inv := tap.inv / 0xffff
+					t[4*x], t[4*x+1], t[4*x+2], t[4*x+3] = r*inv, g*inv, b*inv, a*inv
+				}
+			}
+
+			// Down: from tmp into dst
+			for y := top; y < bottom; y++ {
+				tap := yTaps[y-dr.Min.Y]
+				d := dst.Pix[dst.PixOffset(clip.Min.X, y):]
+				for x := 0; x < tmpW; x++ {
+					var r, g, b, a float64
+					for i, w := range tap.w {
+						t := tmp[4*(tmpW*(tap.first-first+i)+x):]
+						r += float64(t[0] * w)
+						g += float64(t[1] * w)
+						b += float64(t[2] * w)
+						a += float64(t[3] * w)
+					}
+					over(d[4*x:4*x+4:4*x+4], r, g, b, a, tap.inv)
+				}
+			}
+		}
+	})
+}
+
+// Rows of the output scaled at a time.  A 24MP photo shrunk to 4K needs
+// about 70 source rows for them, 9MB.
+const stripRows = 32
+
+// Blends a premultiplied colour, yet to be divided by the total weight, over
+// the pixel.  Overshoot from the filter's negative lobes is clamped.
+func over(d []byte, r, g, b, a, inv float64) {
+	r, g, b = min(r, a), min(g, a), min(b, a)
+	a0 := uint32(ftou(a * inv))
+	a1 := (0xffff - a0) * 0x101
+	d[0] = uint8((uint32(d[0])*a1/0xffff + uint32(ftou(r*inv))) >> 8)
+	d[1] = uint8((uint32(d[1])*a1/0xffff + uint32(ftou(g*inv))) >> 8)
+	d[2] = uint8((uint32(d[2])*a1/0xffff + uint32(ftou(b*inv))) >> 8)
+	d[3] = uint8((uint32(d[3])*a1/0xffff + a0) >> 8)
+}
+
+// A 16 bit channel from 0 to 1
+func ftou(f float64) uint16 {
+	i := int32(float64(0xffff*f) + 0.5)
+	if i > 0xffff {
+		return 0xffff
+	}
+	if i > 0 {
+		return uint16(i)
+	}
+	return 0
+}
+
+// Works out the filter for scaling sn source pixels, starting at offset, to
+// dn.  When shrinking the filter is widened so every source pixel counts.
+// Taps off the edge are left out.
+func filterTaps(dn, sn, offset int) []taps {
+	scale := float64(sn) / float64(dn)
+	support, argScale := 2.0, 1.0
+	if scale > 1 {
+		support *= scale
+		argScale = 1 / scale
+	}
+	out := make([]taps, dn)
+	for d := range out {
+		centre := float64((float64(d)+0.5)*scale) - 0.5
+		lo := max(int(math.Floor(centre-support)), 0)
+		hi := max(min(int(math.Ceil(centre+support)), sn), lo)
+		t := taps{first: offset + lo, w: make([]float64, hi-lo)}
+		var sum float64
+		for i := lo; i < hi; i++ {
+			if x := math.Abs((centre - float64(i)) * argScale); x < 2 {
+				t.w[i-lo] = catmullRom(x)
+				sum += t.w[i-lo]
+			}
+		}
+		t.inv = 1 / sum
+		out[d] = t
+	}
+	return out
+}
+
+func catmullRom(x float64) float64 {
+	if x < 1 {
+		return (1.5*x-2.5)*x*x + 1
+	}
+	return ((-0.5*x+2.5)*x-4)*x + 2
+}
@@ -0,0 +1,171 @@
+package drawing
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+	xdraw "golang.org/x/image/draw"
+)
+
+func noise(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rnd.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+// Runs fn with a given number of workers
+func withWorkers(n int, fn func()) {
+	saved := Workers
+	Workers = n
+	defer func() { Workers = saved }()
+	fn()
+}
+
+func TestScaleParallelMatchesSerial(t *testing.T) {
+	src := noise(640, 480)
+	for _, size := range []image.Rectangle{
+		image.Rect(0, 0, 320, 200),     // Shrink
+		image.Rect(0, 0, 1000, 700),    // Grow
+		image.Rect(-50, -20, 400, 280), // Off the edge as for fill
+	} {
+		var serial, parallel *image.RGBA
+		withWorkers(1, func() {
+			serial = image.NewRGBA(image.Rect(0, 0, 400, 300))
+			Scale(serial, size, src, src.Bounds())
+		})
+		withWorkers(4, func() {
+			parallel = image.NewRGBA(image.Rect(0, 0, 400, 300))
+			Scale(parallel, size, src, src.Bounds())
+		})
+		if !bytes.Equal(serial.Pix, parallel.Pix) {
+			t.Errorf("Scaling to %v differs in parallel", size)
+		}
+	}
+}
+
+// Exactly as x/image did it before, including the edges, drawing over what
+// is there and from part of the source
+func TestScaleLikeCatmullRom(t *testing.T) {
+	src := noise(640, 480)
+	for i := 3; i < len(src.Pix); i += 4 * 7 { // Some see-through pixels
+		a := src.Pix[i] / 2
+		src.Pix[i-3], src.Pix[i-2], src.Pix[i-1], src.Pix[i] = min(src.Pix[i-3], a), min(src.Pix[i-2], a), min(src.Pix[i-1], a), a
+	}
+	for _, c := range []struct {
+		dr, sr image.Rectangle
+	}{
+		{image.Rect(0, 0, 100, 75), src.Bounds()},                       // Shrink a lot
+		{image.Rect(0, 0, 400, 300), src.Bounds()},                      // Shrink a little
+		{image.Rect(0, 0, 400, 300), image.Rect(0, 0, 64, 48)},          // Grow a lot
+		{image.Rect(-50, -20, 450, 330), image.Rect(100, 50, 600, 400)}, // Off the edge as for fill
+		{image.Rect(10, 10, 390, 290), src.Bounds()},                    // Fitted, on a background
+	} {
+		got, want := noise(400, 300), noise(400, 300)
+		Scale(got, c.dr, src, c.sr)
+		xdraw.CatmullRom.Scale(want, c.dr, src, c.sr, xdraw.Over, nil)
+		if i := firstDiff(got.Pix, want.Pix); i >= 0 {
+			t.Errorf("%v of %v: at %d,%d got %v want %v", c.sr, c.dr, i/4%400, i/4/400, got.Pix[i&^3:i&^3+4], want.Pix[i&^3:i&^3+4])
+		}
+	}
+}
+
+func firstDiff(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestCopyParallelMatchesSerial(t *testing.T) {
+	src := noise(800, 600)
+	var serial, parallel *fbimage.BGR565
+	for _, c := range []struct {
+		n   int
+		dst **fbimage.BGR565
+	}{{1, &serial}, {4, &parallel}} {
+		withWorkers(c.n, func() {
+			*c.dst = &fbimage.BGR565{Pix: make([]byte, 2*800*600), Rect: src.Bounds(), Stride: 2 * 800}
+			CopyRGBAtoBGR565(*c.dst, src)
+		})
+	}
+	if !bytes.Equal(serial.Pix, parallel.Pix) {
+		t.Error("Parallel copy differs")
+	}
+}
+
+var benchRuns = []struct {
+	name    string
+	workers int
+}{{"serial", 1}, {"parallel", Workers}}
+
+func BenchmarkCopyRGBAtoBGR565(b *testing.B) {
+	src := noise(3840, 2160)
+	dst := &fbimage.BGR565{Pix: make([]byte, 2*3840*2160), Rect: src.Bounds(), Stride: 2 * 3840}
+	for _, run := range benchRuns {
+		b.Run(run.name, func(b *testing.B) {
+			withWorkers(run.workers, func() {
+				for i := 0; i < b.N; i++ {
+					CopyRGBAtoBGR565(dst, src)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCopyRGBAtoBGRA(b *testing.B) {
+	src := noise(3840, 2160)
+	dst := &fbimage.BGRA{Pix: make([]byte, 4*3840*2160), Rect: src.Bounds(), Stride: 4 * 3840}
+	for _, run := range benchRuns {
+		b.Run(run.name, func(b *testing.B) {
+			withWorkers(run.workers, func() {
+				for i := 0; i < b.N; i++ {
+					CopyRGBAtoBGRA(dst, src)
+				}
+			})
+		})
+	}
+}
+
+// A 24MP photo down to 4K
+func BenchmarkScale(b *testing.B) {
+	src := noise(6000, 4000)
+	dst := image.NewRGBA(image.Rect(0, 0, 3840, 2160))
+	dr := image.Rect(300, 0, 3540, 2160)
+	for _, run := range benchRuns {
+		b.Run(run.name, func(b *testing.B) {
+			withWorkers(run.workers, func() {
+				for i := 0; i < b.N; i++ {
+					Scale(dst, dr, src, src.Bounds())
+				}
+			})
+		})
+	}
+	b.Run("x/image", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			xdraw.CatmullRom.Scale(dst, dr, src, src.Bounds(), xdraw.Src, nil)
+		}
+	})
+}
+
+func BenchmarkCopyRGBAtoBGR565Dithered(b *testing.B) {
+	src := noise(3840, 2160)
+	dst := &fbimage.BGR565{Pix: make([]byte, 2*3840*2160), Rect: src.Bounds(), Stride: 2 * 3840}
+	for _, d := range []Dither{DitherNone, DitherOrdered, DitherDiffusion} {
+		b.Run(d.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				CopyRGBAtoBGR565Dithered(dst, src, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+// Package drm drives a display through the kernel's DRM/KMS interface
+// (/dev/dri/card*) rather than the fbdev emulation, which on recent Raspberry
+// Pi kernels is stuck at 16 bits per pixel and has no vsync.
+//
+// It uses the simplest parts of the API that every driver supports: dumb
+// buffers that are mapped into memory and drawn on by the CPU, the legacy
+// SETCRTC and PAGE_FLIP calls, and uevents for hot-plugging.  It can be tried
+// without a GPU using the kernel's virtual vkms driver:
+//
+//	modprobe vkms
+package drm
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+	"golang.org/x/sys/unix"
+)
+
+// How long to wait for a page flip before giving up on vsync
+const flipTimeout = 500 * time.Millisecond
+
+// Mode is a display resolution offered by a connector
+type Mode struct {
+	Width, Height int
+	Refresh       int // Hz
+	Name          string
+	Preferred     bool
+	info          modeInfo
+}
+
+func (m Mode) String() string {
+	return fmt.Sprintf("%dx%d@%d", m.Width, m.Height, m.Refresh)
+}
+
+// A dumb buffer mapped into memory and registered as a frame buffer
+type buffer struct {
+	handle, fbID, pitch uint32
+	mem                 []byte
+}
+
+// Device is a DRM card driving one connector.  Drawing is on the back buffer
+// returned by Image, Flip shows it at the next vsync.
+type Device struct {
+	fd        int
+	Path      string
+	Connector uint32
+	Crtc      uint32
+	Mode      Mode
+	bufs      [2]*buffer
+	front     int
+	img       *fbimage.BGRA // Always the back buffer
+	saved     *modeCrtc     // What the console had, restored on Close
+}
+
+// Cards lists the DRM devices
+func Cards() ([]string, error) {
+	return filepath.Glob("/dev/dri/card*")
+}
+
+// Open sets up the first connected display on the card at path in its
+// preferred mode, or the first one if wantWidth and wantHeight are zero or
+// don't match any mode.
+func Open(path string, wantWidth, wantHeight int) (*Device, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", path, err)
+	}
+	d := &Device{fd: fd, Path: path}
+	if err := d.setup(wantWidth, wantHeight); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+func (d *Device) setup(wantWidth, wantHeight int) error {
+	// Only fails if someone else is master, in which case SETCRTC will say so
+	ioctl(d.fd, ioctlSetMaster, nil)
+
+	res, err := d.resources()
+	if err != nil {
+		return err
+	}
+	var modes []Mode
+	for _, id := range res.connectors {
+		conn, connModes, err := d.connector(id)
+		if err != nil {
+			return err
+		}
+		if conn.Connection == connected && len(connModes) > 0 {
+			d.Connector, modes = id, connModes
+			d.Crtc, err = d.findCrtc(conn, res.crtcs)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if d.Connector == 0 {
+		return errors.New("no connected display")
+	}
+	d.Mode = chooseMode(modes, wantWidth, wantHeight)
+
+	saved := modeCrtc{CrtcID: d.Crtc}
+	if d.saved == nil && ioctl(d.fd, ioctlGetCrtc, unsafe.Pointer(&saved)) == nil {
+		d.saved = &saved
+	}
+	for i := range d.bufs {
+		if d.bufs[i], err = d.newBuffer(d.Mode.Width, d.Mode.Height); err != nil {
+			return err
+		}
+	}
+	if err := d.setCrtc(d.bufs[0].fbID, &d.Mode.info); err != nil {
+		return err
+	}
+	d.front = 0
+	d.img = &fbimage.BGRA{
+		Pix:    d.bufs[1].mem,
+		Rect:   image.Rect(0, 0, d.Mode.Width, d.Mode.Height),
+		Stride: int(d.bufs[1].pitch),
+	}
+	return nil
+}
+
+type resources struct {
+	crtcs, connectors, encoders []uint32
+}
+
+func (d *Device) resources() (resources, error) {
+	var r cardRes
+	if err := ioctl(d.fd, ioctlGetResources, unsafe.Pointer(&r)); err != nil {
+		return resources{}, fmt.Errorf("get resources: %v", err)
+	}
+	res := resources{
+		crtcs:      make([]uint32, r.CountCrtcs),
+		connectors: make([]uint32, r.CountConnectors),
+		encoders:   make([]uint32, r.CountEncoders),
+	}
+	var pin runtime.Pinner
+	r = cardRes{
+		CrtcIDPtr: slicePtr(&pin, res.crtcs), CountCrtcs: r.CountCrtcs,
+		ConnectorIDPtr: slicePtr(&pin, res.connectors), CountConnectors: r.CountConnectors,
+		EncoderIDPtr: slicePtr(&pin, res.encoders), CountEncoders: r.CountEncoders,
+	}
+	err := ioctl(d.fd, ioctlGetResources, unsafe.Pointer(&r))
+	pin.Unpin()
+	if err != nil {
+		return resources{}, fmt.Errorf("get resources: %v", err)
+	}
+	return res, nil
+}
+
+// Reads a connector and its modes, this probes the display.  The kernel only
+// fills in the modes if there is room so it is asked again if the number
+// changes.
+func (d *Device) connector(id uint32) (getConnector, []Mode, error) {
+	var (
+		c     getConnector
+		infos []modeInfo
+	)
+	for {
+		var pin runtime.Pinner
+		c = getConnector{ConnectorID: id, ModesPtr: slicePtr(&pin, infos), CountModes: uint32(len(infos))}
+		err := ioctl(d.fd, ioctlGetConnector, unsafe.Pointer(&c))
+		pin.Unpin()
+		if err != nil {
+			return c, nil, fmt.Errorf("get connector %d: %v", id, err)
+		}
+		if int(c.CountModes) <= len(infos) {
+			break
+		}
+		infos = make([]modeInfo, c.CountModes)
+	}
+	modes := make([]Mode, 0, c.CountModes)
+	for _, info := range infos[:c.CountModes] {
+		modes = append(modes, Mode{
+			Width:     int(info.Hdisplay),
+			Height:    int(info.Vdisplay),
+			Refresh:   int(info.Vrefresh),
+			Name:      strings.TrimRight(string(info.Name[:]), "\x00"),
+			Preferred: info.Type&modeTypePreferred != 0,
+			info:      info,
+		})
+	}
+	return c, modes, nil
+}
+
+// The CRTC already driving the connector, or the first it could use
+func (d *Device) findCrtc(conn getConnector, crtcs []uint32) (uint32, error) {
+	if conn.EncoderID != 0 {
+		enc := getEncoder{EncoderID: conn.EncoderID}
+		if err := ioctl(d.fd, ioctlGetEncoder, unsafe.Pointer(&enc)); err == nil {
+			if enc.CrtcID != 0 {
+				return enc.CrtcID, nil
+			}
+			for i, id := range crtcs {
+				if enc.PossibleCrtcs&(1<<i) != 0 {
+					return id, nil
+				}
+			}
+		}
+	}
+	if len(crtcs) == 0 {
+		return 0, errors.New("no CRTC")
+	}
+	return crtcs[0], nil
+}
+
+// The wanted size if offered, else the preferred mode, else the first
+func chooseMode(modes []Mode, width, height int) Mode {
+	for _, m := range modes {
+		if m.Width == width && m.Height == height {
+			return m
+		}
+	}
+	for _, m := range modes {
+		if m.Preferred {
+			return m
+		}
+	}
+	return modes[0]
+}
+
+// Modes lists what the connected display offers
+func (d *Device) Modes() ([]Mode, error) {
+	_, modes, err := d.connector(d.Connector)
+	return modes, err
+}
+
+// Connected probes whether the display is still plugged in
+func (d *Device) Connected() (bool, error) {
+	c, _, err := d.connector(d.Connector)
+	return c.Connection == connected, err
+}
+
+func (d *Device) newBuffer(width, height int) (*buffer, error) {
+	create := createDumb{Width: uint32(width), Height: uint32(height), Bpp: 32}
+	if err := ioctl(d.fd, ioctlCreateDumb, unsafe.Pointer(&create)); err != nil {
+		return nil, fmt.Errorf("create dumb buffer: %v", err)
+	}
+	b := &buffer{handle: create.Handle, pitch: create.Pitch}
+	cmd := fbCmd{Width: uint32(width), Height: uint32(height), Pitch: create.Pitch, Bpp: 32, Depth: 24, Handle: create.Handle}
+	if err := ioctl(d.fd, ioctlAddFB, unsafe.Pointer(&cmd)); err != nil {
+		d.freeBuffer(b)
+		return nil, fmt.Errorf("add frame buffer: %v", err)
+	}
+	b.fbID = cmd.FbID
+	m := mapDumb{Handle: create.Handle}
+	if err := ioctl(d.fd, ioctlMapDumb, unsafe.Pointer(&m)); err != nil {
+		d.freeBuffer(b)
+		return nil, fmt.Errorf("map dumb buffer: %v", err)
+	}
+	mem, err := unix.Mmap(d.fd, int64(m.Offset), int(create.Size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		d.freeBuffer(b)
+		return nil, fmt.Errorf("mmap: %v", err)
+	}
+	b.mem = mem
+	return b, nil
+}
+
+func (d *Device) freeBuffer(b *buffer) {
+	if b.mem != nil {
+		unix.Munmap(b.mem)
+	}
+	if b.fbID != 0 {
+		id := b.fbID
+		ioctl(d.fd, ioctlRmFB, unsafe.Pointer(&id))
+	}
+	destroy := destroyDumb{Handle: b.handle}
+	ioctl(d.fd, ioctlDestroyDumb, unsafe.Pointer(&destroy))
+}
+
+// The connector as the array SETCRTC wants.  Like the other arrays handed to
+// the kernel it is pinned, as only the pointer to the struct given to ioctl
+// is kept where it is during the call, not pointers stored in it.
+func (d *Device) connectorPtr(pin *runtime.Pinner) uint64 {
+	return slicePtr(pin, []uint32{d.Connector})
+}
+
+func (d *Device) setCrtc(fbID uint32, mode *modeInfo) error {
+	var pin runtime.Pinner
+	defer pin.Unpin()
+	c := modeCrtc{
+		SetConnectorsPtr: d.connectorPtr(&pin),
+		CountConnectors:  1,
+		CrtcID:           d.Crtc,
+		FbID:             fbID,
+		ModeValid:        1,
+		Mode:             *mode,
+	}
+	if err := ioctl(d.fd, ioctlSetCrtc, unsafe.Pointer(&c)); err != nil {
+		return fmt.Errorf("set CRTC: %v", err)
+	}
+	return nil
+}
+
+// Image is the back buffer in XRGB8888.  It stays the same image across
+// flips, its memory is switched underneath.
+func (d *Device) Image() (draw.Image, error) {
+	return d.img, nil
+}
+
+// Flip shows the back buffer at the next vsync and waits for it.  The damaged
+// areas are then copied to the new back buffer so both stay up to date and
+// only the changes need drawing next time, no damage means all of it.
+func (d *Device) Flip(damage ...image.Rectangle) error {
+	back := 1 - d.front
+	flip := pageFlip{CrtcID: d.Crtc, FbID: d.bufs[back].fbID, Flags: pageFlipEvent}
+	if err := ioctl(d.fd, ioctlPageFlip, unsafe.Pointer(&flip)); err != nil {
+		// Some drivers can't flip, fall back to switching immediately
+		if err := d.setCrtc(d.bufs[back].fbID, &d.Mode.info); err != nil {
+			return err
+		}
+	} else if err := d.waitFlip(); err != nil {
+		return err
+	}
+	d.front = back
+	newBack := d.bufs[1-back]
+	if len(damage) == 0 {
+		damage = []image.Rectangle{d.img.Rect}
+	}
+	for _, r := range damage {
+		r = r.Intersect(d.img.Rect)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			from, to := d.img.PixOffset(r.Min.X, y), d.img.PixOffset(r.Max.X, y)
+			copy(newBack.mem[from:to], d.img.Pix[from:to])
+		}
+	}
+	d.img.Pix = newBack.mem
+	return nil
+}
+
+// Reads events until the flip completes
+func (d *Device) waitFlip() error {
+	deadline := time.Now().Add(flipTimeout)
+	buf := make([]byte, 1024)
+	for {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return errors.New("page flip timed out")
+		}
+		fds := []unix.PollFd{{Fd: int32(d.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(timeout.Milliseconds())+1)
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("poll: %v", err)
+		}
+		n, err = unix.Read(d.fd, buf)
+		if err != nil {
+			return fmt.Errorf("reading events: %v", err)
+		}
+		// struct drm_event { __u32 type; __u32 length; } followed by data
+		for pos := 0; pos+8 <= n; {
+			typ := *(*uint32)(unsafe.Pointer(&buf[pos]))
+			length := int(*(*uint32)(unsafe.Pointer(&buf[pos+4])))
+			if typ == eventFlipComplete {
+				return nil
+			}
+			if length < 8 {
+				break
+			}
+			pos += length
+		}
+	}
+}
+
+// Reset sets the mode again, eg after the display has been unplugged and
+// plugged back in.
+func (d *Device) Reset() error {
+	return d.setCrtc(d.bufs[d.front].fbID, &d.Mode.info)
+}
+
+// Blank turns the CRTC off, which lets the display go into standby, or back
+// on again.  Nothing can be flipped while it is off.
+func (d *Device) Blank(blank bool) error {
+	if !blank {
+		return d.Reset()
+	}
+	c := modeCrtc{CrtcID: d.Crtc}
+	if err := ioctl(d.fd, ioctlSetCrtc, unsafe.Pointer(&c)); err != nil {
+		return fmt.Errorf("set CRTC off: %v", err)
+	}
+	return nil
+}
+
+// Reprobe finds the connected display again after a hotplug, which may be a
+// different one, and sets it to the wanted size or its preferred mode.  If
+// the mode has changed the buffers are made again and Image must be called
+// for the new back buffer.
+func (d *Device) Reprobe(wantWidth, wantHeight int) (changed bool, err error) {
+	old, oldConnector := d.Mode, d.Connector
+	d.Connector = 0
+	res, err := d.resources()
+	if err != nil {
+		d.Connector = oldConnector
+		return false, err
+	}
+	for _, id := range res.connectors {
+		conn, modes, err := d.connector(id)
+		if err == nil && conn.Connection == connected && len(modes) > 0 {
+			if mode := chooseMode(modes, wantWidth, wantHeight); id == oldConnector && mode.Width == old.Width && mode.Height == old.Height {
+				d.Connector = id
+				return false, d.Reset()
+			}
+			break
+		}
+	}
+	for i, b := range d.bufs {
+		if b != nil {
+			d.freeBuffer(b)
+			d.bufs[i] = nil
+		}
+	}
+	d.Connector = 0
+	if err := d.setup(wantWidth, wantHeight); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Driver is the name of the kernel driver, eg vc4 or vkms
+func (d *Device) Driver() (string, error) {
+	return driverName(d.fd)
+}
+
+func driverName(fd int) (string, error) {
+	var v version
+	if err := ioctl(fd, ioctlVersion, unsafe.Pointer(&v)); err != nil {
+		return "", fmt.Errorf("version: %v", err)
+	}
+	name := make([]byte, v.NameLen+1)
+	var pin runtime.Pinner
+	v = version{NameLen: v.NameLen, Name: uintptr(slicePtr(&pin, name))}
+	err := ioctl(fd, ioctlVersion, unsafe.Pointer(&v))
+	pin.Unpin()
+	if err != nil {
+		return "", fmt.Errorf("version: %v", err)
+	}
+	return strings.TrimRight(string(name[:v.NameLen]), "\x00"), nil
+}
+
+// DriverName opens the card at path just to find out its driver
+func DriverName(path string) (string, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+	return driverName(fd)
+}
+
+// Close puts back what was on the screen before and frees the buffers
+func (d *Device) Close() error {
+	if d.saved != nil && d.saved.ModeValid != 0 {
+		var pin runtime.Pinner
+		d.saved.SetConnectorsPtr = d.connectorPtr(&pin)
+		d.saved.CountConnectors = 1
+		ioctl(d.fd, ioctlSetCrtc, unsafe.Pointer(d.saved))
+		pin.Unpin()
+	}
+	for _, b := range d.bufs {
+		if b != nil {
+			d.freeBuffer(b)
+		}
+	}
+	return unix.Close(d.fd)
+}
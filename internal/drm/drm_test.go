@@ -0,0 +1,83 @@
+package drm
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"unsafe"
+)
+
+// Sizes of the kernel structures on 64 bit
+func TestStructSizes(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("sizes are for 64 bit")
+	}
+	for name, c := range map[string]struct{ got, want uintptr }{
+		"drm_version":             {unsafe.Sizeof(version{}), 64},
+		"drm_mode_card_res":       {unsafe.Sizeof(cardRes{}), 64},
+		"drm_mode_modeinfo":       {unsafe.Sizeof(modeInfo{}), 68},
+		"drm_mode_get_connector":  {unsafe.Sizeof(getConnector{}), 80},
+		"drm_mode_get_encoder":    {unsafe.Sizeof(getEncoder{}), 20},
+		"drm_mode_crtc":           {unsafe.Sizeof(modeCrtc{}), 104},
+		"drm_mode_create_dumb":    {unsafe.Sizeof(createDumb{}), 32},
+		"drm_mode_map_dumb":       {unsafe.Sizeof(mapDumb{}), 16},
+		"drm_mode_fb_cmd":         {unsafe.Sizeof(fbCmd{}), 28},
+		"drm_mode_crtc_page_flip": {unsafe.Sizeof(pageFlip{}), 24},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s is %d bytes, want %d", name, c.got, c.want)
+		}
+	}
+	if ioctlGetResources != 0xc04064a0 || ioctlPageFlip != 0xc01864b0 {
+		t.Errorf("ioctl numbers wrong %x %x", ioctlGetResources, ioctlPageFlip)
+	}
+}
+
+func TestIsHotplug(t *testing.T) {
+	msg := []byte("change@/devices/platform/vkms/drm/card0\x00ACTION=change\x00SUBSYSTEM=drm\x00HOTPLUG=1\x00")
+	if !isHotplug(msg) {
+		t.Error("Missed hotplug")
+	}
+	if isHotplug([]byte("add@/devices/usb\x00ACTION=add\x00SUBSYSTEM=usb\x00")) {
+		t.Error("USB isn't a display")
+	}
+}
+
+// Finds a vkms card, which needs root and "modprobe vkms"
+func vkmsCard(t *testing.T) string {
+	cards, _ := Cards()
+	for _, card := range cards {
+		if name, err := DriverName(card); err == nil && name == "vkms" {
+			return card
+		}
+	}
+	t.Skip("no vkms device, try modprobe vkms")
+	return ""
+}
+
+func TestVKMS(t *testing.T) {
+	d, err := Open(vkmsCard(t), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	modes, err := d.Modes()
+	if err != nil || len(modes) == 0 {
+		t.Fatalf("No modes %v", err)
+	}
+	t.Logf("Using %v of %d modes", d.Mode, len(modes))
+
+	img, _ := d.Image()
+	if img.Bounds() != image.Rect(0, 0, d.Mode.Width, d.Mode.Height) {
+		t.Errorf("Image is %v for mode %v", img.Bounds(), d.Mode)
+	}
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	img.Set(10, 10, red)
+	if err := d.Flip(image.Rect(10, 10, 11, 11)); err != nil {
+		t.Fatal(err)
+	}
+	// The new back buffer should have been brought up to date
+	if got := img.At(10, 10); got != red {
+		t.Errorf("After flip got %v, want %v", got, red)
+	}
+}
@@ -0,0 +1,68 @@
+package drm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+
+	"golang.org/x/sys/unix"
+)
+
+// Hotplug signals when a display is connected or disconnected, as told by the
+// kernel's uevents, until ctx is cancelled.
+func Hotplug(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("uevent socket: %v", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("uevent bind: %v", err)
+	}
+	// Wake up now and then to see if ctx is done
+	tv := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("uevent timeout: %v", err)
+	}
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer unix.Close(fd)
+		buf := make([]byte, 8192)
+		for ctx.Err() == nil {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err == unix.EINTR || err == unix.EAGAIN {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("uevent: %v", err)
+				}
+				return
+			}
+			if isHotplug(buf[:n]) {
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// A uevent is "action@devpath" then NUL separated KEY=value pairs
+func isHotplug(msg []byte) bool {
+	var drm, hotplug bool
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		switch string(field) {
+		case "SUBSYSTEM=drm":
+			drm = true
+		case "HOTPLUG=1":
+			hotplug = true
+		}
+	}
+	return drm && hotplug
+}
@@ -0,0 +1,140 @@
+package drm
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Kernel structures from drm.h and drm_mode.h.  Fields are in the same order
+// and sizes so Go lays them out the same way.
+
+type version struct {
+	Major, Minor, Patchlevel int32
+	NameLen                  uintptr
+	Name                     uintptr
+	DateLen                  uintptr
+	Date                     uintptr
+	DescLen                  uintptr
+	Desc                     uintptr
+}
+
+type cardRes struct {
+	FbIDPtr, CrtcIDPtr, ConnectorIDPtr, EncoderIDPtr uint64
+	CountFbs, CountCrtcs, CountConnectors            uint32
+	CountEncoders                                    uint32
+	MinWidth, MaxWidth, MinHeight, MaxHeight         uint32
+}
+
+type modeInfo struct {
+	Clock                                         uint32
+	Hdisplay, HsyncStart, HsyncEnd, Htotal, Hskew uint16
+	Vdisplay, VsyncStart, VsyncEnd, Vtotal, Vscan uint16
+	Vrefresh                                      uint32
+	Flags                                         uint32
+	Type                                          uint32
+	Name                                          [32]byte
+}
+
+type getConnector struct {
+	EncodersPtr, ModesPtr, PropsPtr, PropValuesPtr uint64
+	CountModes, CountProps, CountEncoders          uint32
+	EncoderID, ConnectorID                         uint32
+	ConnectorType, ConnectorTypeID                 uint32
+	Connection                                     uint32
+	MmWidth, MmHeight                              uint32
+	Subpixel                                       uint32
+	Pad                                            uint32
+}
+
+type getEncoder struct {
+	EncoderID, EncoderType, CrtcID uint32
+	PossibleCrtcs, PossibleClones  uint32
+}
+
+type modeCrtc struct {
+	SetConnectorsPtr uint64
+	CountConnectors  uint32
+	CrtcID, FbID     uint32
+	X, Y             uint32
+	GammaSize        uint32
+	ModeValid        uint32
+	Mode             modeInfo
+}
+
+type createDumb struct {
+	Height, Width, Bpp, Flags uint32
+	Handle, Pitch             uint32
+	Size                      uint64
+}
+
+type mapDumb struct {
+	Handle, Pad uint32
+	Offset      uint64
+}
+
+type destroyDumb struct {
+	Handle uint32
+}
+
+type fbCmd struct {
+	FbID, Width, Height, Pitch, Bpp, Depth, Handle uint32
+}
+
+type pageFlip struct {
+	CrtcID, FbID, Flags, Reserved uint32
+	UserData                      uint64
+}
+
+const (
+	connected = 1 // drm_connector_status
+
+	modeTypePreferred = 1 << 3
+	pageFlipEvent     = 0x01
+	eventFlipComplete = 0x02
+)
+
+// ioctl numbers, _IOWR('d', nr, size) in the generic Linux encoding
+func iowr(nr uintptr, size uintptr) uintptr {
+	return 3<<30 | size<<16 | 'd'<<8 | nr
+}
+
+var (
+	ioctlVersion      = iowr(0x00, unsafe.Sizeof(version{}))
+	ioctlSetMaster    = uintptr('d'<<8 | 0x1e)
+	ioctlGetResources = iowr(0xa0, unsafe.Sizeof(cardRes{}))
+	ioctlGetCrtc      = iowr(0xa1, unsafe.Sizeof(modeCrtc{}))
+	ioctlSetCrtc      = iowr(0xa2, unsafe.Sizeof(modeCrtc{}))
+	ioctlGetEncoder   = iowr(0xa6, unsafe.Sizeof(getEncoder{}))
+	ioctlGetConnector = iowr(0xa7, unsafe.Sizeof(getConnector{}))
+	ioctlAddFB        = iowr(0xae, unsafe.Sizeof(fbCmd{}))
+	ioctlRmFB         = iowr(0xaf, unsafe.Sizeof(uint32(0)))
+	ioctlPageFlip     = iowr(0xb0, unsafe.Sizeof(pageFlip{}))
+	ioctlCreateDumb   = iowr(0xb2, unsafe.Sizeof(createDumb{}))
+	ioctlMapDumb      = iowr(0xb3, unsafe.Sizeof(mapDumb{}))
+	ioctlDestroyDumb  = iowr(0xb4, unsafe.Sizeof(destroyDumb{}))
+)
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, eno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+		switch eno {
+		case 0:
+			return nil
+		case unix.EINTR, unix.EAGAIN:
+			continue
+		}
+		return eno
+	}
+}
+
+// Pointer to the first element of s for the kernel to fill, 0 if empty.  It
+// is pinned so it can't move during the ioctl, unpin it after.
+func slicePtr[T any](pin *runtime.Pinner, s []T) uint64 {
+	if len(s) == 0 {
+		return 0
+	}
+	pin.Pin(&s[0])
+	return uint64(uintptr(unsafe.Pointer(&s[0])))
+}
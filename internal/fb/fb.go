@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"image"
 	"image/draw"
+	"os"
 	"unsafe"
 
 	"github.com/drummonds/gophoto/internal/fbimage"
@@ -32,12 +33,18 @@ import (
 )
 
 type Device struct {
-	Fd    uintptr
-	mmap  []byte
-	FInfo FixScreeninfo
+	Fd      uintptr
+	mmap    []byte
+	FInfo   FixScreeninfo
+	virtual []byte // All of the file of a virtual device, nil for a real one
 }
 
+// Open opens a frame buffer device, or a virtual one if dev is a regular file
+// made by CreateVirtual.
 func Open(dev string) (*Device, error) {
+	if st, err := os.Stat(dev); err == nil && st.Mode().IsRegular() {
+		return OpenVirtual(dev)
+	}
 	fd, err := unix.Open(dev, unix.O_RDWR|unix.O_CLOEXEC, 0)
 	if err != nil {
 		return nil, fmt.Errorf("open %s: %v", dev, err)
@@ -63,6 +70,9 @@ func Open(dev string) (*Device, error) {
 }
 
 func (d *Device) VarScreeninfo() (VarScreeninfo, error) {
+	if d.virtual != nil {
+		return *d.virtualVar(), nil
+	}
 	var vinfo VarScreeninfo
 	_, _, eno := unix.Syscall(unix.SYS_IOCTL, d.Fd, FBIOGET_VSCREENINFO, uintptr(unsafe.Pointer(&vinfo)))
 	if eno != 0 {
@@ -71,72 +81,210 @@ func (d *Device) VarScreeninfo() (VarScreeninfo, error) {
 	return vinfo, nil
 }
 
+// SetMode asks the driver for a new mode with FBIOPUT_VSCREENINFO, then
+// rereads the screen info and remaps the frame buffer memory.  Zero bpp, xres
+// or yres keep the current setting.  Drivers that can't change mode, like the
+// Raspberry Pi's vc4drmfb, return an error and the device is left as it was.
+// The mode the driver settled on is returned as it may not be what was asked.
+func (d *Device) SetMode(bpp, xres, yres int) (VarScreeninfo, error) {
+	vinfo, err := d.VarScreeninfo()
+	if err != nil {
+		return vinfo, err
+	}
+	want := wantedMode(vinfo, bpp, xres, yres)
+	if want == vinfo {
+		return vinfo, nil
+	}
+	if d.virtual != nil {
+		return want, d.setVirtualMode(want)
+	}
+	if err := d.putMode(want); err != nil {
+		return vinfo, err
+	}
+	if err := d.remap(); err != nil {
+		// Put the old mode back so the frame buffer can still be drawn on
+		if d.putMode(vinfo) == nil && d.remap() == nil {
+			return vinfo, fmt.Errorf("%v, kept the old mode", err)
+		}
+		return vinfo, err
+	}
+	got, err := d.VarScreeninfo()
+	if err != nil {
+		return got, err
+	}
+	if bpp != 0 && int(got.Bits_per_pixel) != bpp {
+		return got, fmt.Errorf("driver chose %d bits per pixel instead of %d", got.Bits_per_pixel, bpp)
+	}
+	return got, nil
+}
+
+func (d *Device) putMode(vinfo VarScreeninfo) error {
+	vinfo.Activate = 0 // FB_ACTIVATE_NOW
+	_, _, eno := unix.Syscall(unix.SYS_IOCTL, d.Fd, FBIOPUT_VSCREENINFO, uintptr(unsafe.Pointer(&vinfo)))
+	if eno != 0 {
+		return fmt.Errorf("FBIOPUT_VSCREENINFO: %v", eno)
+	}
+	return nil
+}
+
+// Maps the memory again after a mode change, as it may have changed size.
+// If it can't be mapped it is left unmapped so Image fails rather than
+// drawing on freed memory.
+func (d *Device) remap() error {
+	_, _, eno := unix.Syscall(unix.SYS_IOCTL, d.Fd, FBIOGET_FSCREENINFO, uintptr(unsafe.Pointer(&d.FInfo)))
+	if eno != 0 {
+		return fmt.Errorf("FBIOGET_FSCREENINFO: %v", eno)
+	}
+	if d.mmap != nil {
+		if err := unix.Munmap(d.mmap); err != nil {
+			return fmt.Errorf("munmap: %v", err)
+		}
+		d.mmap = nil
+	}
+	mem, err := unix.Mmap(int(d.Fd), 0, int(d.FInfo.Smem_len), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("mmap: %v", err)
+	}
+	d.mmap = mem
+	return nil
+}
+
+// The mode asked for by SetMode
+func wantedMode(vinfo VarScreeninfo, bpp, xres, yres int) VarScreeninfo {
+	want := vinfo
+	if bpp != 0 {
+		want.Bits_per_pixel = uint32(bpp)
+		want.Transp = Bitfield{}
+		switch bpp {
+		case 32, 24:
+			want.Red, want.Green, want.Blue = Bitfield{Offset: 16, Length: 8}, Bitfield{Offset: 8, Length: 8}, Bitfield{Offset: 0, Length: 8}
+		case 16:
+			want.Red, want.Green, want.Blue = Bitfield{Offset: 11, Length: 5}, Bitfield{Offset: 5, Length: 6}, Bitfield{Offset: 0, Length: 5}
+		}
+	}
+	if xres != 0 && yres != 0 {
+		want.Xres, want.Yres = uint32(xres), uint32(yres)
+		want.Xres_virtual, want.Yres_virtual = uint32(xres), uint32(yres)
+		want.Xoffset, want.Yoffset = 0, 0
+	}
+	return want
+}
+
+// Pan shows the part of the virtual resolution starting at x, y.  With a
+// virtual height of twice the screen this flips between two buffers.
+func (d *Device) Pan(x, y int) error {
+	vinfo, err := d.VarScreeninfo()
+	if err != nil {
+		return err
+	}
+	if x < 0 || y < 0 || x+int(vinfo.Xres) > int(vinfo.Xres_virtual) || y+int(vinfo.Yres) > int(vinfo.Yres_virtual) {
+		return fmt.Errorf("pan to %d,%d outside virtual resolution %dx%d", x, y, vinfo.Xres_virtual, vinfo.Yres_virtual)
+	}
+	vinfo.Xoffset, vinfo.Yoffset = uint32(x), uint32(y)
+	if d.virtual != nil {
+		*d.virtualVar() = vinfo
+		return nil
+	}
+	_, _, eno := unix.Syscall(unix.SYS_IOCTL, d.Fd, FBIOPAN_DISPLAY, uintptr(unsafe.Pointer(&vinfo)))
+	if eno != 0 {
+		return fmt.Errorf("FBIOPAN_DISPLAY: %v", eno)
+	}
+	return nil
+}
+
+// Values for Blank, from linux/fb.h
+const (
+	blankUnblank   = 0 // FB_BLANK_UNBLANK
+	blankPowerdown = 4 // FB_BLANK_POWERDOWN, the screen goes into standby
+)
+
+// Blank powers the screen down, or back up.  A virtual device has no screen.
+func (d *Device) Blank(blank bool) error {
+	if d.virtual != nil {
+		return nil
+	}
+	mode := uintptr(blankUnblank)
+	if blank {
+		mode = blankPowerdown
+	}
+	_, _, eno := unix.Syscall(unix.SYS_IOCTL, d.Fd, FBIOBLANK, mode)
+	if eno != 0 {
+		return fmt.Errorf("FBIOBLANK: %v", eno)
+	}
+	return nil
+}
+
+// Format is the pixel format described by the bitfields of vinfo
+func Format(vinfo VarScreeninfo) fbimage.Format {
+	field := func(b Bitfield) fbimage.Field {
+		return fbimage.Field{Offset: uint(b.Offset), Length: uint(b.Length)}
+	}
+	return fbimage.Format{
+		BitsPerPixel: int(vinfo.Bits_per_pixel),
+		Red:          field(vinfo.Red),
+		Green:        field(vinfo.Green),
+		Blue:         field(vinfo.Blue),
+		Trans:        field(vinfo.Transp),
+	}
+}
+
+// Image gives the frame buffer as an image, using the quickest
+// implementation for its pixel format.
 func (d *Device) Image() (draw.Image, error) {
+	if d.mmap == nil {
+		return nil, errors.New("frame buffer memory isn't mapped after a failed mode change")
+	}
 	vinfo, err := d.VarScreeninfo()
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: select the correct stride and implementation not only based on bpp,
-	// but also on the offsets of the pixels.
+	// {Xres:3840 Yres:2160 Xres_virtual:3840 Yres_virtual:2160 Xoffset:0 Yoffset:0 Bits_per_pixel:16 Grayscale:0
+	// Red:{Offset:11 Length:5 Right:0}
+	// Green:{Offset:5 Length:6 Right:0}
+	// Blue:{Offset:0 Length:5 Right:0} Transp:{Offset:0 Length:0 Right:0} Nonstd:0 Activate:0 Height:290 Width:520 Accel_flags:1 Pixclock:0 Left_margin:0 Right_margin:0 Upper_margin:0 Lower_margin:0 Hsync_len:0 Vsync_len:0 Sync:0 Vmode:0 Rotate:0 Colorspace:0 Reserved:[0 0 0 0]}
+	bytesPerPixel := (int(vinfo.Bits_per_pixel) + 7) / 8
+	stride := int(d.FInfo.Line_length)
+	virtual := image.Rect(0, 0, int(vinfo.Xres_virtual), int(vinfo.Yres_virtual))
+	if virtual.Dy()*stride > len(d.mmap) || virtual.Dx()*bytesPerPixel > stride {
+		return nil, errors.New("virtual resolution doesn't match framebuffer size")
+	}
+	offset := image.Pt(int(vinfo.Xoffset), int(vinfo.Yoffset))
+	visual := image.Rect(0, 0, int(vinfo.Xres), int(vinfo.Yres))
+	if !visual.Add(offset).In(virtual) {
+		return nil, errors.New("visual resolution not contained in virtual resolution")
+	}
+	// The image always starts at 0,0, panned to show the visible part
+	pix := d.mmap[offset.Y*stride+offset.X*bytesPerPixel:]
 
-	if vinfo.Bits_per_pixel == 32 {
+	format := Format(vinfo)
+	switch {
+	case vinfo.Grayscale == 1 && vinfo.Bits_per_pixel == 16:
+		return &image.Gray16{Pix: pix, Stride: stride, Rect: visual}, nil
+	case format.Red == fbimage.FormatXRGB8888.Red && format.Green == fbimage.FormatXRGB8888.Green &&
+		format.Blue == fbimage.FormatXRGB8888.Blue && format.BitsPerPixel == 32:
 		// The Linux efifb driver typically defaults to 32 bpp.
-
-		virtual := image.Rect(0, 0, int(vinfo.Xres_virtual), int(vinfo.Yres_virtual))
-		if virtual.Dx()*virtual.Dy()*4 != len(d.mmap) {
-			return nil, errors.New("virtual resolution doesn't match framebuffer size")
-		}
-		visual := image.Rect(int(vinfo.Xoffset), int(vinfo.Yoffset), int(vinfo.Xres), int(vinfo.Yres))
-		if !visual.In(virtual) {
-			return nil, errors.New("visual resolution not contained in virtual resolution")
-		}
-		stride := int(d.FInfo.Line_length)
-
-		return &fbimage.BGRA{
-			Pix:    d.mmap,
-			Stride: stride,
-			Rect:   visual,
-		}, nil
-	} else if vinfo.Bits_per_pixel == 16 {
+		return &fbimage.BGRA{Pix: pix, Stride: stride, Rect: visual}, nil
+	case format == fbimage.FormatRGB565:
 		// The Raspberry Pi vc4drmfb does not offer 32 bpp, and cannot be
 		// reconfigured at runtime.
-
-		// {Xres:3840 Yres:2160 Xres_virtual:3840 Yres_virtual:2160 Xoffset:0 Yoffset:0 Bits_per_pixel:16 Grayscale:0
-		// Red:{Offset:11 Length:5 Right:0}
-		// Green:{Offset:5 Length:6 Right:0}
-		// Blue:{Offset:0 Length:5 Right:0} Transp:{Offset:0 Length:0 Right:0} Nonstd:0 Activate:0 Height:290 Width:520 Accel_flags:1 Pixclock:0 Left_margin:0 Right_margin:0 Upper_margin:0 Lower_margin:0 Hsync_len:0 Vsync_len:0 Sync:0 Vmode:0 Rotate:0 Colorspace:0 Reserved:[0 0 0 0]}
-
-		virtual := image.Rect(0, 0, int(vinfo.Xres_virtual), int(vinfo.Yres_virtual))
-		if virtual.Dx()*virtual.Dy()*2 != len(d.mmap) {
-			return nil, errors.New("virtual resolution doesn't match framebuffer size")
-		}
-		visual := image.Rect(int(vinfo.Xoffset), int(vinfo.Yoffset), int(vinfo.Xres), int(vinfo.Yres))
-		if !visual.In(virtual) {
-			return nil, errors.New("visual resolution not contained in virtual resolution")
-		}
-		stride := int(d.FInfo.Line_length)
-
-		if vinfo.Grayscale == 1 {
-			return &image.Gray16{
-				Pix:    d.mmap,
-				Stride: stride,
-				Rect:   visual,
-			}, nil
-		} else {
-			return &fbimage.BGR565{
-				Pix:    d.mmap,
-				Stride: stride,
-				Rect:   visual,
-			}, nil
-		}
-	} else {
-		return nil, fmt.Errorf("%d bits per pixel unsupported", vinfo.Bits_per_pixel)
+		return &fbimage.BGR565{Pix: pix, Stride: stride, Rect: visual}, nil
 	}
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	return &fbimage.Packed{Pix: pix, Stride: stride, Rect: visual, Format: format}, nil
 }
 
 func (d *Device) Close() error {
-	e1 := unix.Munmap(d.mmap)
+	mem := d.mmap
+	if d.virtual != nil {
+		mem = d.virtual
+	}
+	var e1 error
+	if mem != nil {
+		e1 = unix.Munmap(mem)
+	}
 	if e2 := unix.Close(int(d.Fd)); e2 != nil {
 		return e2
 	}
@@ -0,0 +1,130 @@
+package fb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+	"golang.org/x/sys/unix"
+)
+
+// A virtual frame buffer is a regular file that starts with a header holding
+// the screen info, so other programs like fbdump can make sense of it, and
+// then the pixels a page in.
+const (
+	virtualMagic      = "gophoto virtual frame buffer\n"
+	virtualVarOffset  = 32
+	virtualFixOffset  = virtualVarOffset + (int(unsafe.Sizeof(VarScreeninfo{}))+7)&^7
+	virtualHeaderSize = 4096
+)
+
+// CreateVirtual makes a virtual frame buffer in the file at path, replacing
+// anything there.  It is width by height in the given pixel format, with a
+// virtual height of twice that so it can be panned between two buffers.  It
+// works like a real device without needing one, for development and tests.
+func CreateVirtual(path string, width, height int, format fbimage.Format) (*Device, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("virtual frame buffer %dx%d has no size", width, height)
+	}
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CREAT|unix.O_TRUNC|unix.O_CLOEXEC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", path, err)
+	}
+	d := &Device{Fd: uintptr(fd)}
+	id := "gophoto virtual"
+	for i := 0; i < len(id); i++ {
+		d.FInfo.Id[i] = int8(id[i])
+	}
+	d.FInfo.Visual = 2 // FB_VISUAL_TRUECOLOR
+	d.FInfo.Ypanstep = 1
+	bitfield := func(f fbimage.Field) Bitfield { return Bitfield{Offset: uint32(f.Offset), Length: uint32(f.Length)} }
+	vinfo := VarScreeninfo{
+		Xres: uint32(width), Yres: uint32(height),
+		Xres_virtual: uint32(width), Yres_virtual: uint32(2 * height),
+		Bits_per_pixel: uint32(format.BitsPerPixel),
+		Red:            bitfield(format.Red),
+		Green:          bitfield(format.Green),
+		Blue:           bitfield(format.Blue),
+		Transp:         bitfield(format.Trans),
+	}
+	if err := d.setVirtualMode(vinfo); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// OpenVirtual opens a virtual frame buffer made by CreateVirtual
+func OpenVirtual(path string) (*Device, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", path, err)
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("stat %s: %v", path, err)
+	}
+	if st.Size < virtualHeaderSize {
+		unix.Close(fd)
+		return nil, fmt.Errorf("%s is too small to be a virtual frame buffer", path)
+	}
+	mem, err := unix.Mmap(fd, 0, int(st.Size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("mmap: %v", err)
+	}
+	d := &Device{Fd: uintptr(fd), virtual: mem}
+	if !bytes.HasPrefix(mem, []byte(virtualMagic)) {
+		d.Close()
+		return nil, fmt.Errorf("%s is not a virtual frame buffer", path)
+	}
+	d.FInfo = *d.virtualFix()
+	if virtualHeaderSize+int(d.FInfo.Smem_len) > len(mem) {
+		d.Close()
+		return nil, errors.New("virtual frame buffer is shorter than its header says")
+	}
+	d.mmap = mem[virtualHeaderSize : virtualHeaderSize+int(d.FInfo.Smem_len)]
+	return d, nil
+}
+
+func (d *Device) virtualVar() *VarScreeninfo {
+	return (*VarScreeninfo)(unsafe.Pointer(&d.virtual[virtualVarOffset]))
+}
+
+func (d *Device) virtualFix() *FixScreeninfo {
+	return (*FixScreeninfo)(unsafe.Pointer(&d.virtual[virtualFixOffset]))
+}
+
+// Sizes the file for the mode and maps it again.  Unlike a real driver any
+// mode is accepted.
+func (d *Device) setVirtualMode(vinfo VarScreeninfo) error {
+	bytesPerPixel := (int(vinfo.Bits_per_pixel) + 7) / 8
+	d.FInfo.Line_length = uint32(int(vinfo.Xres_virtual) * bytesPerPixel)
+	d.FInfo.Smem_len = d.FInfo.Line_length * vinfo.Yres_virtual
+	size := virtualHeaderSize + int(d.FInfo.Smem_len)
+	if d.virtual != nil {
+		if err := unix.Munmap(d.virtual); err != nil {
+			return fmt.Errorf("munmap: %v", err)
+		}
+		d.virtual, d.mmap = nil, nil
+	}
+	if err := unix.Ftruncate(int(d.Fd), int64(size)); err != nil {
+		return fmt.Errorf("sizing virtual frame buffer: %v", err)
+	}
+	mem, err := unix.Mmap(int(d.Fd), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("mmap: %v", err)
+	}
+	d.virtual = mem
+	copy(mem, virtualMagic)
+	*d.virtualVar() = vinfo
+	*d.virtualFix() = d.FInfo
+	d.mmap = mem[virtualHeaderSize:]
+	return nil
+}
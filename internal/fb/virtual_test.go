@@ -0,0 +1,70 @@
+package fb
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/drummonds/gophoto/internal/fbimage"
+)
+
+func TestVirtual(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fb")
+	d, err := CreateVirtual(path, 64, 48, fbimage.FormatRGB565)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := d.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*fbimage.BGR565); !ok || img.Bounds() != image.Rect(0, 0, 64, 48) {
+		t.Fatalf("image %T %v, want BGR565 64x48", img, img.Bounds())
+	}
+	red := color.RGBA{255, 0, 0, 255}
+	img.Set(3, 4, red)
+
+	// Showing the second buffer
+	if err := d.Pan(0, 48); err != nil {
+		t.Fatal(err)
+	}
+	back, _ := d.Image()
+	back.Set(3, 4, color.RGBA{0, 0, 255, 255})
+	if err := d.Pan(0, 96); err == nil {
+		t.Error("panned past the end")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another program sees the same
+	d, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	vinfo, _ := d.VarScreeninfo()
+	if vinfo.Xres != 64 || vinfo.Yres != 48 || vinfo.Yoffset != 48 || Format(vinfo) != fbimage.FormatRGB565 {
+		t.Errorf("screen info %+v", vinfo)
+	}
+	if err := d.Pan(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	img, _ = d.Image()
+	if r, g, b, _ := img.At(3, 4).RGBA(); r>>8 < 0xf8 || g != 0 || b != 0 {
+		t.Errorf("pixel %v, want red", img.At(3, 4))
+	}
+
+	got, err := d.SetMode(32, 100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _ = d.Image()
+	if got.Bits_per_pixel != 32 || img.Bounds() != image.Rect(0, 0, 100, 50) {
+		t.Errorf("after SetMode %d bpp %v", got.Bits_per_pixel, img.Bounds())
+	}
+	if _, ok := img.(*fbimage.BGRA); !ok {
+		t.Errorf("32 bpp image is %T, want BGRA", img)
+	}
+}
@@ -0,0 +1,195 @@
+package fbimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Field is where a colour channel sits in a pixel value, like the kernel's
+// fb_bitfield.  A zero length means the channel isn't there.
+type Field struct {
+	Offset, Length uint
+}
+
+func (f Field) mask() uint32 { return 1<<f.Length - 1 }
+
+// Packs an 8 bit channel value into the field
+func (f Field) pack(v uint8) uint32 {
+	if f.Length == 0 {
+		return 0
+	}
+	return (uint32(v) >> (8 - f.Length) & f.mask()) << f.Offset
+}
+
+// Unpacks the field into 8 bits, replicating the top bits into the gap
+func (f Field) unpack(p uint32) uint8 {
+	if f.Length == 0 {
+		return 0
+	}
+	v := (p >> f.Offset) & f.mask()
+	v <<= 8 - f.Length
+	for shift := f.Length; shift < 8; shift *= 2 {
+		v |= v >> shift
+	}
+	return uint8(v)
+}
+
+// Format describes how pixels are packed into little endian values of up to
+// 32 bits, as given by a frame buffer's VarScreeninfo.
+type Format struct {
+	BitsPerPixel            int
+	Red, Green, Blue, Trans Field
+}
+
+// Some common formats, named from the most significant bits down
+var (
+	FormatRGB565   = Format{16, Field{11, 5}, Field{5, 6}, Field{0, 5}, Field{}} // The BGR565 image
+	FormatBGR565   = Format{16, Field{0, 5}, Field{5, 6}, Field{11, 5}, Field{}}
+	FormatRGB888   = Format{24, Field{16, 8}, Field{8, 8}, Field{0, 8}, Field{}}
+	FormatBGR888   = Format{24, Field{0, 8}, Field{8, 8}, Field{16, 8}, Field{}}
+	FormatXRGB8888 = Format{32, Field{16, 8}, Field{8, 8}, Field{0, 8}, Field{}} // The BGRA image
+	FormatARGB8888 = Format{32, Field{16, 8}, Field{8, 8}, Field{0, 8}, Field{24, 8}}
+	FormatXBGR8888 = Format{32, Field{0, 8}, Field{8, 8}, Field{16, 8}, Field{}}
+	FormatABGR8888 = Format{32, Field{0, 8}, Field{8, 8}, Field{16, 8}, Field{24, 8}}
+	FormatRGBA8888 = Format{32, Field{24, 8}, Field{16, 8}, Field{8, 8}, Field{0, 8}}
+)
+
+func (f Format) BytesPerPixel() int { return (f.BitsPerPixel + 7) / 8 }
+
+// Check the format can be handled
+func (f Format) Validate() error {
+	if f.BitsPerPixel <= 0 || f.BitsPerPixel > 32 || f.BitsPerPixel%8 != 0 {
+		return fmt.Errorf("%d bits per pixel unsupported", f.BitsPerPixel)
+	}
+	for _, c := range []Field{f.Red, f.Green, f.Blue, f.Trans} {
+		if c.Length > 8 || int(c.Offset+c.Length) > f.BitsPerPixel {
+			return fmt.Errorf("pixel format %v unsupported", f)
+		}
+	}
+	if f.Red.Length == 0 || f.Green.Length == 0 || f.Blue.Length == 0 {
+		return fmt.Errorf("pixel format %v has no colour", f)
+	}
+	return nil
+}
+
+// ByteAligned reports whether every channel is a whole byte, in which case
+// the byte index of each channel is returned.  Missing alpha gives -1.
+func (f Format) ByteAligned() (r, g, b, a int, ok bool) {
+	index := func(c Field) (int, bool) {
+		if c.Length == 0 {
+			return -1, true
+		}
+		return int(c.Offset / 8), c.Length == 8 && c.Offset%8 == 0
+	}
+	r, rok := index(f.Red)
+	g, gok := index(f.Green)
+	b, bok := index(f.Blue)
+	a, aok := index(f.Trans)
+	return r, g, b, a, rok && gok && bok && aok && f.Red.Length != 0
+}
+
+// Name such as RGB565 or XRGB8888, channels named from the top bits down
+func (f Format) String() string {
+	type channel struct {
+		name string
+		Field
+	}
+	channels := []channel{{"R", f.Red}, {"G", f.Green}, {"B", f.Blue}, {"A", f.Trans}}
+	var names, sizes strings.Builder
+	for bit := f.BitsPerPixel - 1; bit >= 0; {
+		found := false
+		for _, c := range channels {
+			if c.Length > 0 && int(c.Offset+c.Length-1) == bit {
+				names.WriteString(c.name)
+				fmt.Fprint(&sizes, c.Length)
+				bit -= int(c.Length)
+				found = true
+				break
+			}
+		}
+		if !found { // Padding
+			end := bit
+			for bit >= 0 && !f.covers(bit) {
+				bit--
+			}
+			names.WriteString("X")
+			fmt.Fprint(&sizes, end-bit)
+		}
+	}
+	return names.String() + sizes.String()
+}
+
+func (f Format) covers(bit int) bool {
+	for _, c := range []Field{f.Red, f.Green, f.Blue, f.Trans} {
+		if c.Length > 0 && bit >= int(c.Offset) && bit < int(c.Offset+c.Length) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pack converts a colour to its pixel value
+func (f Format) Pack(c color.RGBA) uint32 {
+	return f.Red.pack(c.R) | f.Green.pack(c.G) | f.Blue.pack(c.B) | f.Trans.pack(c.A)
+}
+
+// Unpack converts a pixel value to a colour, opaque if there is no alpha
+func (f Format) Unpack(p uint32) color.RGBA {
+	c := color.RGBA{f.Red.unpack(p), f.Green.unpack(p), f.Blue.unpack(p), 0xff}
+	if f.Trans.Length > 0 {
+		c.A = f.Trans.unpack(p)
+	}
+	return c
+}
+
+// Packed is an image in any Format.  It is slow to draw on pixel by pixel,
+// the drawing package has quick copies for common formats.
+type Packed struct {
+	Pix    []byte
+	Rect   image.Rectangle
+	Stride int
+	Format Format
+}
+
+func (i *Packed) Bounds() image.Rectangle { return i.Rect }
+func (i *Packed) ColorModel() color.Model { return color.RGBAModel }
+
+func (i *Packed) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return color.RGBA{}
+	}
+	return i.Format.Unpack(i.pixel(i.PixOffset(x, y)))
+}
+
+func (i *Packed) Set(x, y int, c color.Color) {
+	i.SetRGBA(x, y, color.RGBAModel.Convert(c).(color.RGBA))
+}
+
+func (i *Packed) SetRGBA(x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+	i.SetPixel(i.PixOffset(x, y), i.Format.Pack(c))
+}
+
+// Pixel values are little endian
+func (i *Packed) pixel(offset int) uint32 {
+	var p uint32
+	for b := i.Format.BytesPerPixel() - 1; b >= 0; b-- {
+		p = p<<8 | uint32(i.Pix[offset+b])
+	}
+	return p
+}
+
+// SetPixel stores a packed pixel value at offset
+func (i *Packed) SetPixel(offset int, p uint32) {
+	for b := 0; b < i.Format.BytesPerPixel(); b++ {
+		i.Pix[offset+b] = byte(p >> (8 * b))
+	}
+}
+
+func (i *Packed) PixOffset(x, y int) int {
+	return (y-i.Rect.Min.Y)*i.Stride + (x-i.Rect.Min.X)*i.Format.BytesPerPixel()
+}
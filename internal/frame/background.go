@@ -0,0 +1,139 @@
+// Backgrounds for the bars left around a photo that is scaled to fit
+
+package frame
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/disintegration/gift"
+	"github.com/drummonds/gophoto/internal/drawing"
+	xdraw "golang.org/x/image/draw"
+)
+
+// BackgroundMode selects how the bars around a letterboxed photo are filled.
+type BackgroundMode int
+
+const (
+	BackgroundPlain    BackgroundMode = iota // Fixed background colour
+	BackgroundBlur                           // Blurred and darkened copy of the photo filling the screen
+	BackgroundAverage                        // Average colour of the photo
+	BackgroundDominant                       // Most common colour of the photo
+	BackgroundGradient                       // Gradient between the colours of the edges next to the bars
+)
+
+var backgroundModeNames = []string{"plain", "blur", "average", "dominant", "gradient"}
+
+func (m BackgroundMode) String() string {
+	if int(m) < 0 || int(m) >= len(backgroundModeNames) {
+		return fmt.Sprintf("BackgroundMode(%d)", int(m))
+	}
+	return backgroundModeNames[m]
+}
+
+// ParseBackgroundMode converts a name such as "blur" into a mode.  An empty
+// string gives the plain background.
+func ParseBackgroundMode(s string) (BackgroundMode, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return BackgroundPlain, nil
+	}
+	for i, name := range backgroundModeNames {
+		if s == name {
+			return BackgroundMode(i), nil
+		}
+	}
+	return BackgroundPlain, fmt.Errorf("unknown background mode %q", s)
+}
+
+const (
+	blurShrink     = 16   // The blurred background is built at 1/16 of the screen size
+	blurSigma      = 5    // Gaussian blur sigma in pixels of the shrunk image
+	blurBrightness = -35  // Percentage change in brightness of the blurred background
+	colourDarken   = 0.6  // Darkening of average and dominant colour backgrounds
+	edgeFraction   = 0.05 // Fraction of the photo used to sample an edge colour
+)
+
+// PaintBackground fills the whole of dst with a background for img.
+// plain is the colour used by BackgroundPlain.
+func PaintBackground(dst *image.RGBA, img image.Image, mode BackgroundMode, plain color.RGBA) {
+	switch mode {
+	case BackgroundBlur:
+		paintBlur(dst, img)
+	case BackgroundAverage:
+		c := drawing.Darken(drawing.AverageColour(img, img.Bounds()), colourDarken)
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	case BackgroundDominant:
+		c := drawing.Darken(drawing.DominantColour(img), colourDarken)
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	case BackgroundGradient:
+		paintGradient(dst, img)
+	default:
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{plain}, image.Point{}, draw.Src)
+	}
+}
+
+// The blur is done on a small copy and then stretched back up, which is much
+// quicker than blurring a 4K image and looks the same once it is out of focus.
+func paintBlur(dst *image.RGBA, img image.Image) {
+	b := dst.Bounds()
+	w := (b.Dx() + blurShrink - 1) / blurShrink
+	h := (b.Dy() + blurShrink - 1) / blurShrink
+	g := gift.New(
+		gift.ResizeToFill(w, h, gift.LinearResampling, gift.CenterAnchor),
+		gift.GaussianBlur(blurSigma),
+		gift.Brightness(blurBrightness),
+	)
+	small := image.NewRGBA(g.Bounds(img.Bounds()))
+	g.Draw(small, img)
+	xdraw.BiLinear.Scale(dst, b, small, small.Bounds(), draw.Src, nil)
+}
+
+// Fades from the colour of one edge of the photo to the opposite edge.  The
+// direction follows the bars so a portrait photo gets a left to right
+// gradient and a panorama a top to bottom one.
+func paintGradient(dst *image.RGBA, img image.Image) {
+	b := dst.Bounds()
+	src := img.Bounds()
+	srcAspect := float64(src.Dx()) / float64(src.Dy())
+	dstAspect := float64(b.Dx()) / float64(b.Dy())
+	horizontal := srcAspect < dstAspect
+
+	var from, to color.RGBA
+	if horizontal {
+		edge := max(1, int(float64(src.Dx())*edgeFraction))
+		from = drawing.AverageColour(img, image.Rect(src.Min.X, src.Min.Y, src.Min.X+edge, src.Max.Y))
+		to = drawing.AverageColour(img, image.Rect(src.Max.X-edge, src.Min.Y, src.Max.X, src.Max.Y))
+	} else {
+		edge := max(1, int(float64(src.Dy())*edgeFraction))
+		from = drawing.AverageColour(img, image.Rect(src.Min.X, src.Min.Y, src.Max.X, src.Min.Y+edge))
+		to = drawing.AverageColour(img, image.Rect(src.Min.X, src.Max.Y-edge, src.Max.X, src.Max.Y))
+	}
+	from = drawing.Darken(from, colourDarken)
+	to = drawing.Darken(to, colourDarken)
+
+	n := b.Dy()
+	if horizontal {
+		n = b.Dx()
+	}
+	for i := 0; i < n; i++ {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+		c := color.RGBA{
+			R: uint8(float64(from.R) + (float64(to.R)-float64(from.R))*t),
+			G: uint8(float64(from.G) + (float64(to.G)-float64(from.G))*t),
+			B: uint8(float64(from.B) + (float64(to.B)-float64(from.B))*t),
+			A: 0xff,
+		}
+		line := image.Rect(b.Min.X, b.Min.Y+i, b.Max.X, b.Min.Y+i+1)
+		if horizontal {
+			line = image.Rect(b.Min.X+i, b.Min.Y, b.Min.X+i+1, b.Max.Y)
+		}
+		draw.Draw(dst, line, &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,110 @@
+// Drawing panels with effects: opacity, rounded corners and drop shadows.
+//
+// A panel with effects is rendered into its own layer which is then blended
+// onto the frame through a mask.  Panels without effects are drawn straight
+// onto the frame as that is much quicker for a full screen photo.
+
+package frame
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+const shadowOpacity = 0.5 // Darkness of a drop shadow
+
+type effects struct {
+	mask       *image.Alpha // Shape and opacity of the panel
+	layer      *image.RGBA  // The panel is rendered here first
+	shadow     *image.Alpha // nil if no shadow
+	shadowRect image.Rectangle
+}
+
+// Creates the effects for a panel covering rect, nil if it has none.  Radius
+// and shadow are in pixels.
+func newEffects(rect image.Rectangle, opacity float64, radius, shadow int) *effects {
+	opacity = math.Max(0, math.Min(1, opacity))
+	if opacity == 1 && radius <= 0 && shadow <= 0 {
+		return nil
+	}
+	e := &effects{
+		mask:  roundedMask(rect, radius, opacity),
+		layer: image.NewRGBA(rect),
+	}
+	if shadow > 0 {
+		e.shadowRect = rect.Inset(-shadow).Add(image.Pt(shadow/2, shadow/2))
+		// Blur the panel's shape, working from the origin for gift
+		shape := roundedMask(rect.Sub(rect.Min).Add(image.Pt(shadow, shadow)), radius, opacity*shadowOpacity)
+		canvas := image.NewAlpha(image.Rect(0, 0, e.shadowRect.Dx(), e.shadowRect.Dy()))
+		draw.Draw(canvas, shape.Rect, shape, shape.Rect.Min, draw.Src)
+		e.shadow = image.NewAlpha(canvas.Bounds())
+		gift.New(gift.GaussianBlur(float32(shadow)/3)).Draw(e.shadow, canvas)
+		e.shadow.Rect = e.shadowRect
+	}
+	return e
+}
+
+// An anti-aliased rounded rectangle filling r with the given opacity
+func roundedMask(r image.Rectangle, radius int, opacity float64) *image.Alpha {
+	mask := image.NewAlpha(r)
+	rad := float64(radius)
+	rad = math.Min(rad, float64(min(r.Dx(), r.Dy()))/2)
+	full := uint8(opacity*0xff + 0.5)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// Distance into the corner square, if in one
+			px, py := float64(x)+0.5, float64(y)+0.5
+			dx := math.Max(float64(r.Min.X)+rad-px, px-(float64(r.Max.X)-rad))
+			dy := math.Max(float64(r.Min.Y)+rad-py, py-(float64(r.Max.Y)-rad))
+			a := full
+			if dx > 0 && dy > 0 {
+				cover := rad - math.Hypot(dx, dy) + 0.5
+				a = uint8(math.Max(0, math.Min(1, cover)) * float64(full))
+			}
+			mask.Pix[mask.PixOffset(x, y)] = a
+		}
+	}
+	return mask
+}
+
+// Area the panel draws on including its shadow
+func (p *framePanel) bounds() image.Rectangle {
+	if p.effects != nil && p.effects.shadow != nil {
+		return p.rect.Union(p.effects.shadowRect)
+	}
+	return p.rect
+}
+
+// Draws the part of the panel within area onto dst
+func (p *framePanel) draw(dst *image.RGBA, area image.Rectangle) {
+	e := p.effects
+	if e == nil {
+		r := p.rect.Intersect(area)
+		if r.Empty() {
+			return
+		}
+		clip := dst.SubImage(r).(*image.RGBA)
+		if p.background.A != 0 {
+			draw.Draw(clip, r, &image.Uniform{p.background}, image.Point{}, draw.Over)
+		}
+		p.Render(clip)
+		return
+	}
+
+	if e.shadow != nil {
+		if r := e.shadowRect.Intersect(area); !r.Empty() {
+			draw.DrawMask(dst, r, image.Black, image.Point{}, e.shadow, r.Min, draw.Over)
+		}
+	}
+	r := p.rect.Intersect(area)
+	if r.Empty() {
+		return
+	}
+	layer := e.layer.SubImage(r).(*image.RGBA)
+	draw.Draw(layer, r, &image.Uniform{p.background}, image.Point{}, draw.Src)
+	p.Render(layer)
+	draw.DrawMask(dst, r, layer, r.Min, e.mask, r.Min, draw.Over)
+}
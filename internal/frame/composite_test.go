@@ -0,0 +1,106 @@
+package frame
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// A panel filled with one colour
+type fill color.RGBA
+
+func (f fill) Render(buffer *image.RGBA) {
+	draw.Draw(buffer, buffer.Rect, &image.Uniform{color.RGBA(f)}, image.Point{}, draw.Src)
+}
+
+var (
+	white = fill{0xff, 0xff, 0xff, 0xff}
+	red   = fill{0xff, 0, 0, 0xff}
+	green = fill{0, 0xff, 0, 0xff}
+	blue  = fill{0, 0, 0xff, 0xff}
+)
+
+// A frame on black with one panel covering r with the effects
+func framed(t *testing.T, size, r image.Rectangle, opacity float64, radius, shadow int) *PictureFrame {
+	pf := NewPictureFrame(size)
+	t.Cleanup(func() { pf.Close() })
+	pf.SetBGColour(0, 0, 0)
+	pf.panels = append(pf.panels, framePanel{Panelled: white, rect: r, effects: newEffects(r, opacity, radius, shadow)})
+	pf.RenderPanels()
+	return pf
+}
+
+func TestOpacity(t *testing.T) {
+	pf := framed(t, image.Rect(0, 0, 20, 20), image.Rect(5, 5, 15, 15), 0.5, 0, 0)
+	if got := pf.Buffer.RGBAAt(10, 10); got.R < 0x7f || got.R > 0x80 || got.R != got.B {
+		t.Errorf("under a half opaque white panel %v, want half grey", got)
+	}
+	if got := pf.Buffer.RGBAAt(2, 2); got.R != 0 {
+		t.Errorf("beside the panel %v, want black", got)
+	}
+}
+
+func TestRoundedCorners(t *testing.T) {
+	pf := framed(t, image.Rect(0, 0, 20, 20), image.Rect(0, 0, 20, 20), 1, 8, 0)
+	for _, c := range []struct {
+		x, y     int
+		min, max uint8
+	}{
+		{0, 0, 0, 0},         // Cut off
+		{19, 19, 0, 0},       // And the opposite one
+		{2, 2, 1, 0xfe},      // Anti-aliased on the curve
+		{10, 0, 0xff, 0xff},  // The edge between corners is straight
+		{10, 10, 0xff, 0xff}, // Middle
+	} {
+		if got := pf.Buffer.RGBAAt(c.x, c.y).G; got < c.min || got > c.max {
+			t.Errorf("at %d,%d %d, want %d to %d", c.x, c.y, got, c.min, c.max)
+		}
+	}
+}
+
+func TestShadow(t *testing.T) {
+	pf := NewPictureFrame(image.Rect(0, 0, 50, 50))
+	defer pf.Close()
+	r := image.Rect(10, 10, 30, 30)
+	pf.panels = append(pf.panels, framePanel{Panelled: red, rect: r, effects: newEffects(r, 1, 0, 6)})
+	pf.BGColour = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	pf.RepaintBackground()
+	pf.RenderPanels()
+	below, above := pf.Buffer.RGBAAt(31, 31).G, pf.Buffer.RGBAAt(8, 8).G
+	if below >= 0xff {
+		t.Errorf("no shadow below the panel")
+	}
+	if above <= below {
+		t.Errorf("shadow above the panel %d is as dark as below %d, it should be offset down", above, below)
+	}
+	if got := pf.Buffer.RGBAAt(45, 45); got.G != 0xff {
+		t.Errorf("away from the panel %v, want the background", got)
+	}
+	if got := pf.Buffer.RGBAAt(20, 20); got != color.RGBA(red) {
+		t.Errorf("panel %v over its shadow, want red", got)
+	}
+}
+
+func TestStacking(t *testing.T) {
+	pf := NewPictureFrame(image.Rect(0, 0, 4, 4))
+	defer pf.Close()
+	pf.AddPanelAt(red, 1)
+	pf.AddPanelAt(blue, 0)
+	pf.AddPanelAt(green, 1)
+	want := []Panelled{blue, red, green} // By z, then in the order added
+	for i, p := range pf.panels {
+		if p.Panelled != want[i] {
+			t.Errorf("panel %d is %v, want %v", i, p.Panelled, want[i])
+		}
+	}
+	pf.RenderPanels()
+	if got := pf.Buffer.RGBAAt(1, 1); got != color.RGBA(green) {
+		t.Errorf("top of the stack %v, want green", got)
+	}
+
+	pf.AddPanel(white) // On top of the highest
+	if p := pf.panels[len(pf.panels)-1]; p.Panelled != white || p.z != 1 {
+		t.Errorf("added panel is %v at %d, want white on top", p.Panelled, p.z)
+	}
+}
@@ -13,10 +13,14 @@ package frame
 
 import (
 	"image"
+	"sort"
 
 	"image/color"
 	"image/draw"
 
+	"github.com/drummonds/gophoto/internal/meta"
+	"github.com/drummonds/gophoto/internal/panel"
+
 	_ "embed"
 	_ "image/png"
 )
@@ -25,6 +29,19 @@ type Panelled interface {
 	Render(buffer *image.RGBA)
 }
 
+// A panel as placed on the frame.  Drawing is clipped to rect.
+type framePanel struct {
+	Panelled
+	widget     panel.Widget // If the panel is a widget
+	rect       image.Rectangle
+	z          int        // Panels with higher z are drawn on top
+	background color.RGBA // Painted behind the panel unless transparent
+	effects    *effects   // Opacity, rounded corners and shadow, nil if none
+}
+
+// Default colour for the background of the frame
+var DefaultBGColour = color.RGBA{R: 0x94, G: 0x6F, B: 0x22, A: 255}
+
 // This is the structure which holds the screen data.
 type PictureFrame struct {
 	// config
@@ -32,7 +49,8 @@ type PictureFrame struct {
 	scaleFactor float64
 	Buffer      *image.RGBA // This is what is output to the screen via the frame buffer
 	BGColour    color.RGBA
-	panels      []Panelled
+	panels      []framePanel // In drawing order, lowest first
+	runner      *panel.Runner
 	CropPoint   image.Point
 }
 
@@ -41,11 +59,12 @@ type PictureFrame struct {
 func NewPictureFrame(bounds image.Rectangle) *PictureFrame {
 	pf := new(PictureFrame)
 	pf.Bounds = bounds
-	pf.BGColour = color.RGBA{R: 0x94, G: 0x6F, B: 0x22, A: 255}
+	pf.BGColour = DefaultBGColour
 	// Create intermediate buffer
 	pf.Buffer = image.NewRGBA(pf.Bounds)
 	pf.RepaintBackground()
-	pf.panels = make([]Panelled, 0, 5)
+	pf.panels = make([]framePanel, 0, 5)
+	pf.runner = panel.NewRunner()
 	return pf
 }
 
@@ -58,18 +77,121 @@ func (pf *PictureFrame) RepaintBackground() {
 	draw.Draw(pf.Buffer, pf.Bounds, &image.Uniform{pf.BGColour}, image.Point{}, draw.Src)
 }
 
+// Adds a panel on top of the others, it may draw anywhere on the frame
 func (pf *PictureFrame) AddPanel(panel Panelled) error {
-	pf.panels = append(pf.panels, panel)
+	z := 0
+	if len(pf.panels) > 0 {
+		z = pf.panels[len(pf.panels)-1].z
+	}
+	return pf.AddPanelAt(panel, z)
+}
+
+// Adds a panel at depth z, above any panels with the same or lower z and
+// below those with a higher one.
+func (pf *PictureFrame) AddPanelAt(panel Panelled, z int) error {
+	pf.panels = append(pf.panels, framePanel{Panelled: panel, rect: pf.Bounds, z: z})
+	sortPanels(pf.panels)
 	return nil
 }
 
-// Calls all the child panels to rerender them
+// Orders panels by z keeping the order they were added otherwise
+func sortPanels(panels []framePanel) {
+	sort.SliceStable(panels, func(i, j int) bool { return panels[i].z < panels[j].z })
+}
+
+// Calls all the child panels to rerender them.  As everything is redrawn any
+// damage reported by the widgets is forgotten.
 func (pf *PictureFrame) RenderPanels() error {
-	for _, panel := range pf.panels {
-		// Recreate panel content if changed
-		panel.Render(pf.Buffer)
-		// apply panel content to buffer
-		// pf.picture.Render(pf.buffer, photoRect)
-	}
+	pf.runner.Damage()
+	pf.renderPanels(pf.Bounds)
 	return nil
 }
+
+// Renders the panels within area
+func (pf *PictureFrame) renderPanels(area image.Rectangle) {
+	for i := range pf.panels {
+		if p := &pf.panels[i]; p.bounds().Overlaps(area) {
+			p.draw(pf.Buffer, area)
+		}
+	}
+}
+
+// RenderDamage redraws only the parts of the frame that widgets have changed
+// since the last render and returns them, so only they need to be copied to
+// the screen.  Panels must not have changed size or the photo changed, for
+// that use RenderPanels.
+func (pf *PictureFrame) RenderDamage() []image.Rectangle {
+	damage := mergeRects(pf.runner.Damage())
+	for i, r := range damage {
+		r = r.Intersect(pf.Bounds)
+		damage[i] = r
+		draw.Draw(pf.Buffer, r, &image.Uniform{pf.BGColour}, image.Point{}, draw.Src)
+		pf.renderPanels(r)
+	}
+	return damage
+}
+
+// Joins overlapping rectangles so nothing is drawn or copied twice
+func mergeRects(rects []image.Rectangle) []image.Rectangle {
+	merged := make([]image.Rectangle, 0, len(rects))
+	for _, r := range rects {
+		if r.Empty() {
+			continue
+		}
+		for i := 0; i < len(merged); {
+			if merged[i].Overlaps(r) {
+				r = r.Union(merged[i])
+				merged = append(merged[:i], merged[i+1:]...)
+				i = 0 // The bigger rectangle may overlap earlier ones
+				continue
+			}
+			i++
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Changed signals when a widget has updated itself and the frame needs to
+// be redrawn.
+func (pf *PictureFrame) Changed() <-chan struct{} {
+	return pf.runner.Changed()
+}
+
+// Close stops the widgets
+func (pf *PictureFrame) Close() error {
+	return pf.runner.Close()
+}
+
+// PhotoRect returns where the photo is shown, so it can be scaled to fit.
+// This is the whole frame if the layout has no photo panel.
+func (pf *PictureFrame) PhotoRect() image.Rectangle {
+	for _, p := range pf.panels {
+		if photo, ok := p.widget.(*panel.PhotoPanel); ok {
+			return photo.Location
+		}
+	}
+	return pf.Bounds
+}
+
+// SetPhoto shows img in all the photo panels. It should already be scaled to
+// the size given by PhotoRect.
+func (pf *PictureFrame) SetPhoto(img image.Image) {
+	for _, p := range pf.panels {
+		if photo, ok := p.widget.(*panel.PhotoPanel); ok {
+			photo.SetImage(img)
+		}
+	}
+}
+
+// SetInfo gives the details of the current photo to any captions
+func (pf *PictureFrame) SetInfo(info meta.Info) {
+	for _, p := range pf.panels {
+		if caption, ok := p.widget.(*panel.CaptionPanel); ok {
+			caption.SetInfo(info)
+			if r, ok := p.Panelled.(*panel.Running); ok {
+				r.Wake()
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Screen layouts read from JSON so that new ones don't need recompiling.
+//
+// Positions and sizes are fractions of the screen, so {"x": 0.5, "w": 0.5}
+// is the right hand half whatever the resolution.  For example:
+//
+//	{
+//	    "name": "captioned",
+//	    "background": "#000000",
+//	    "panels": [
+//	        {"type": "photo", "x": 0, "y": 0, "w": 1, "h": 0.9},
+//	        {"type": "text", "x": 0.05, "y": 0.85, "w": 0.9, "h": 0.1, "z": 1,
+//	         "padding": 0.01, "background": "#202020", "opacity": 0.7,
+//	         "radius": 0.02, "shadow": 0.01, "text": "Holidays"}
+//	    ]
+//	}
+
+package frame
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/drummonds/gophoto/internal/panel"
+)
+
+//go:embed layouts/*.json
+var layoutFS embed.FS
+
+// Layout describes the panels that make up the screen
+type Layout struct {
+	Name       string        `json:"name"`
+	Background string        `json:"background,omitempty"` // Colour of the frame as #rrggbb
+	Panels     []PanelLayout `json:"panels"`
+}
+
+// PanelLayout places one panel on the screen.
+type PanelLayout struct {
+	Type       string   `json:"type"` // Registered widget name eg photo, clock, caption, text or image
+	X          float64  `json:"x"`    // Fraction of the screen width
+	Y          float64  `json:"y"`    // Fraction of the screen height
+	W          float64  `json:"w"`
+	H          float64  `json:"h"`
+	Z          int      `json:"z,omitempty"`          // Higher panels are drawn on top
+	Padding    float64  `json:"padding,omitempty"`    // Fraction of the screen height kept clear inside the panel
+	Background string   `json:"background,omitempty"` // Colour behind the panel as #rrggbb or #rrggbbaa, none if empty
+	Opacity    *float64 `json:"opacity,omitempty"`    // Of the whole panel from 0 to 1 (default)
+	Radius     float64  `json:"radius,omitempty"`     // Of rounded corners, fraction of the screen height
+	Shadow     float64  `json:"shadow,omitempty"`     // Size of a drop shadow, fraction of the screen height
+	Text       string   `json:"text,omitempty"`       // For text panels
+	Src        string   `json:"src,omitempty"`        // Image file for image panels, the built in photo if empty
+	Fit        string   `json:"fit,omitempty"`        // For image panels: fit (default) or fill
+
+	// Settings for the widget, see the widget for what it understands
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// ParseLayout reads a layout from JSON
+func ParseLayout(data []byte) (*Layout, error) {
+	l := new(Layout)
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("parsing layout: %v", err)
+	}
+	for i, p := range l.Panels {
+		if p.W <= 0 || p.H <= 0 {
+			return nil, fmt.Errorf("layout %s panel %d (%s) has no size", l.Name, i, p.Type)
+		}
+	}
+	return l, nil
+}
+
+// LoadLayout reads a layout from a file, or if there is no such file one of
+// the built in layouts such as photo, full or bounded.
+func LoadLayout(name string) (*Layout, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) && !strings.ContainsRune(name, '/') {
+		data, err = layoutFS.ReadFile(path.Join("layouts", strings.TrimSuffix(name, ".json")+".json"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("layout %s: %v", name, err)
+	}
+	return ParseLayout(data)
+}
+
+// Layouts lists the names of the built in layouts
+func Layouts() []string {
+	entries, _ := layoutFS.ReadDir("layouts")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return names
+}
+
+// Rect converts the relative panel position to pixels within bounds
+func (p PanelLayout) Rect(bounds image.Rectangle) image.Rectangle {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	return image.Rect(
+		bounds.Min.X+int(p.X*w+0.5), bounds.Min.Y+int(p.Y*h+0.5),
+		bounds.Min.X+int((p.X+p.W)*w+0.5), bounds.Min.Y+int((p.Y+p.H)*h+0.5),
+	)
+}
+
+// Area inside the padding where the content goes
+func (p PanelLayout) contentRect(bounds image.Rectangle) image.Rectangle {
+	pad := int(p.Padding*float64(bounds.Dy()) + 0.5)
+	return p.Rect(bounds).Inset(pad)
+}
+
+// Effects for the panel, nil if it is plain
+func (p PanelLayout) effects(bounds image.Rectangle) *effects {
+	opacity := 1.0
+	if p.Opacity != nil {
+		opacity = *p.Opacity
+	}
+	h := float64(bounds.Dy())
+	return newEffects(p.Rect(bounds), opacity, int(p.Radius*h+0.5), int(p.Shadow*h+0.5))
+}
+
+// Widget configuration for the panel.  Text, src and fit are shorthands for
+// options.
+func (p PanelLayout) config(bounds image.Rectangle) panel.Config {
+	options := make(map[string]string, len(p.Options)+3)
+	for k, v := range p.Options {
+		options[k] = v
+	}
+	for k, v := range map[string]string{"text": p.Text, "src": p.Src, "fit": p.Fit} {
+		if v != "" {
+			options[k] = v
+		}
+	}
+	return panel.Config{Name: p.Type, Location: p.contentRect(bounds), Options: options}
+}
+
+// Create the widget described by the layout from the registry
+func newLayoutWidget(p PanelLayout) (panel.Widget, error) {
+	if p.Type == "image" && p.Src == "" {
+		img, _, err := image.Decode(bytes.NewReader(displayPhotoPNG))
+		if err != nil {
+			return nil, fmt.Errorf("decoding built in photo: %v", err)
+		}
+		return panel.NewImagePanel(img), nil
+	}
+	return panel.New(p.Type)
+}
+
+// ApplyLayout replaces the panels of the frame with those described by the
+// layout.  Widgets keep updating themselves until ctx is cancelled or the
+// layout is replaced.  Everything is made before any widget is started, so
+// a bad layout leaves the old one running.  If a widget then fails to start
+// the frame is left without panels.
+func (pf *PictureFrame) ApplyLayout(ctx context.Context, l *Layout) error {
+	bg := pf.BGColour
+	if l.Background != "" {
+		var err error
+		if bg, err = panel.ParseColour(l.Background); err != nil {
+			return err
+		}
+	}
+	panels := make([]framePanel, 0, len(l.Panels))
+	for _, spec := range l.Panels {
+		fp := framePanel{rect: spec.Rect(pf.Bounds), z: spec.Z, effects: spec.effects(pf.Bounds)}
+		if spec.Background != "" {
+			c, err := panel.ParseColour(spec.Background)
+			if err != nil {
+				return fmt.Errorf("layout %s: %v", l.Name, err)
+			}
+			fp.background = c
+		}
+		w, err := newLayoutWidget(spec)
+		if err != nil {
+			return fmt.Errorf("layout %s: %v", l.Name, err)
+		}
+		fp.widget = w
+		panels = append(panels, fp)
+	}
+
+	if err := pf.runner.Close(); err != nil {
+		log.Printf("Closing old layout: %v", err)
+	}
+	pf.panels = nil
+	pf.BGColour = bg
+	for i, spec := range l.Panels {
+		running, err := pf.runner.Start(ctx, panels[i].widget, spec.config(pf.Bounds))
+		if err != nil {
+			if err := pf.runner.Close(); err != nil {
+				log.Printf("Closing half started layout: %v", err)
+			}
+			pf.RepaintBackground()
+			return fmt.Errorf("layout %s panel %s: %v", l.Name, spec.Type, err)
+		}
+		panels[i].Panelled = running
+	}
+	sortPanels(panels)
+	pf.panels = panels
+	pf.RepaintBackground()
+	return nil
+}
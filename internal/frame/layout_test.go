@@ -0,0 +1,61 @@
+package frame
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/panel"
+)
+
+var started atomic.Int32 // Test widgets running
+
+// A widget that counts itself, failing to start if fail is set
+type counted struct{ fail bool }
+
+func (c *counted) Init(ctx context.Context, cfg panel.Config) error {
+	if c.fail {
+		return errors.New("can't start")
+	}
+	started.Add(1)
+	return nil
+}
+func (c *counted) Update(ctx context.Context, now time.Time) (bool, error) { return false, nil }
+func (c *counted) Render(buffer *image.RGBA)                               {}
+func (c *counted) Interval() time.Duration                                 { return time.Hour }
+func (c *counted) Close() error                                            { started.Add(-1); return nil }
+
+func init() {
+	panel.Register("test-counted", func() panel.Widget { return &counted{} })
+	panel.Register("test-broken", func() panel.Widget { return &counted{fail: true} })
+}
+
+func TestBadLayoutStopsWidgets(t *testing.T) {
+	pf := NewPictureFrame(image.Rect(0, 0, 16, 9))
+	defer pf.Close()
+	ctx := context.Background()
+	good := &Layout{Name: "good", Panels: []PanelLayout{{Type: "test-counted", W: 1, H: 1}}}
+	if err := pf.ApplyLayout(ctx, good); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not made, so the good layout keeps going
+	unknown := &Layout{Name: "unknown", Panels: []PanelLayout{{Type: "test-counted", W: 1, H: 1}, {Type: "no-such-widget"}}}
+	if err := pf.ApplyLayout(ctx, unknown); err == nil {
+		t.Error("layout with an unknown widget applied")
+	}
+	if n := started.Load(); n != 1 || len(pf.panels) != 1 {
+		t.Errorf("%d widgets running and %d panels after an unknown widget, want the old one", n, len(pf.panels))
+	}
+
+	broken := &Layout{Name: "broken", Panels: []PanelLayout{{Type: "test-counted", W: 1, H: 1}, {Type: "test-broken"}}}
+	if err := pf.ApplyLayout(ctx, broken); err == nil {
+		t.Error("layout with a widget that can't start applied")
+	}
+	if n := started.Load(); n != 0 || len(pf.panels) != 0 {
+		t.Errorf("%d widgets running and %d panels after one failed to start, want none", n, len(pf.panels))
+	}
+}
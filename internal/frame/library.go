@@ -0,0 +1,181 @@
+package frame
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/drummonds/photoprism-go-api/api"
+)
+
+// Source is somewhere in PhotoPrism photos can come from, an album, a label
+// or a person, for choosing the playlist.
+type Source struct {
+	UID   string // Album or subject UID, or label slug, as in settings.Playlist
+	Title string
+	Thumb string // Hash of the cover photo
+	Count int    // Photos
+}
+
+// How many of each are listed
+const maxSources = 500
+
+var errNotConnected = errors.New("not connected to PhotoPrism yet")
+
+// Albums lists the albums in PhotoPrism
+func Albums(ctx context.Context) ([]Source, error) {
+	if GlobalPage.Client == nil {
+		return nil, errNotConnected
+	}
+	order := "name"
+	albums, err := GlobalPage.Client.SearchAlbumsWithResponse(ctx, &api.SearchAlbumsParams{Count: maxSources, Order: &order})
+	if err != nil {
+		return nil, err
+	}
+	if albums.JSON200 == nil {
+		return nil, fmt.Errorf("listing albums: %s", albums.HTTPResponse.Status)
+	}
+	sources := make([]Source, 0, len(*albums.JSON200))
+	for _, a := range *albums.JSON200 {
+		s := Source{UID: deref(a.UID), Title: deref(a.Title), Thumb: deref(a.Thumb)}
+		if a.PhotoCount != nil {
+			s.Count = *a.PhotoCount
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// A label or subject as PhotoPrism lists them.  The generated client doesn't
+// have these so they are fetched directly.
+type photoprismItem struct {
+	UID        string
+	Slug       string
+	Name       string
+	Thumb      string
+	PhotoCount int
+}
+
+// Labels lists the labels in PhotoPrism, by slug
+func Labels(ctx context.Context) ([]Source, error) {
+	var labels []photoprismItem
+	if err := photoprismGet(ctx, "/api/v1/labels", url.Values{"count": {fmt.Sprint(maxSources)}}, &labels); err != nil {
+		return nil, fmt.Errorf("listing labels: %v", err)
+	}
+	sources := make([]Source, 0, len(labels))
+	for _, l := range labels {
+		sources = append(sources, Source{UID: l.Slug, Title: l.Name, Thumb: l.Thumb, Count: l.PhotoCount})
+	}
+	return sources, nil
+}
+
+// People lists the people PhotoPrism has recognised
+func People(ctx context.Context) ([]Source, error) {
+	var people []photoprismItem
+	query := url.Values{"count": {fmt.Sprint(maxSources)}, "type": {"person"}, "order": {"name"}}
+	if err := photoprismGet(ctx, "/api/v1/subjects", query, &people); err != nil {
+		return nil, fmt.Errorf("listing people: %v", err)
+	}
+	sources := make([]Source, 0, len(people))
+	for _, p := range people {
+		sources = append(sources, Source{UID: p.UID, Title: p.Name, Thumb: p.Thumb, Count: p.PhotoCount})
+	}
+	return sources, nil
+}
+
+// Thumbnail fetches a small JPEG of the photo with file hash, size is one of
+// PhotoPrism's such as tile_100 or tile_224.
+func Thumbnail(ctx context.Context, hash, size string) ([]byte, error) {
+	if GlobalPage.Client == nil {
+		return nil, errNotConnected
+	}
+	token, err := previewToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := GlobalPage.Client.GetThumbWithResponse(ctx, hash, token, size)
+	if err != nil {
+		return nil, err
+	}
+	if thumb.HTTPResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("thumbnail %s: %s", hash, thumb.HTTPResponse.Status)
+	}
+	return thumb.Body, nil
+}
+
+// Thumbnails need PhotoPrism's preview token rather than the app password
+var preview struct {
+	sync.Mutex
+	token string
+}
+
+func previewToken(ctx context.Context) (string, error) {
+	preview.Lock()
+	defer preview.Unlock()
+	if preview.token != "" {
+		return preview.token, nil
+	}
+	var config struct {
+		PreviewToken string `json:"previewToken"`
+	}
+	if err := photoprismGet(ctx, "/api/v1/config", nil, &config); err != nil {
+		return "", fmt.Errorf("getting preview token: %v", err)
+	}
+	preview.token = config.PreviewToken
+	if preview.token == "" {
+		preview.token = "public" // What PhotoPrism uses without authentication
+	}
+	return preview.token, nil
+}
+
+// Gets a PhotoPrism API path as JSON into v
+func photoprismGet(ctx context.Context, path string, query url.Values, v any) error {
+	return photoprismDo(ctx, http.MethodGet, path, query, nil, v)
+}
+
+// Calls the PhotoPrism API for what the generated client lacks.  The body is
+// sent as JSON if not nil and the reply read into v if that isn't nil.
+func photoprismDo(ctx context.Context, method, path string, query url.Values, body, v any) error {
+	u := strings.TrimSuffix(os.Getenv("PHOTOPRISM_DOMAIN"), "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := api.NewXAuthProvider(os.Getenv("PHOTOPRISM_TOKEN")).Intercept(ctx, req); err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,119 @@
+// Favourites, ratings and hiding photos.  What is said is kept in the local
+// overrides and, for photos from PhotoPrism, written back there too.
+
+package frame
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/drummonds/gophoto/internal/overrides"
+	"github.com/drummonds/photoprism-go-api/api"
+)
+
+// PhotoPrism has no ratings so they are kept as labels, eg "Rating 4", which
+// can then be chosen for the playlist.
+const ratingLabel = "Rating "
+
+// IsFavourite is true if the photo has been marked as a favourite here or in
+// PhotoPrism
+func IsFavourite(p *Photo) bool {
+	if p.Info != nil && p.Info.Favorite != nil {
+		return *p.Info.Favorite
+	}
+	return overrides.Get(p.UID).Favourite
+}
+
+// Rating of the photo from 1 to 5, 0 if it hasn't been rated
+func Rating(p *Photo) int {
+	return overrides.Get(p.UID).Rating
+}
+
+// SetFavourite marks the photo as a favourite or not
+func SetFavourite(ctx context.Context, p *Photo, on bool) error {
+	if _, err := overrides.Update(p.UID, func(o *overrides.Override) { o.Favourite = on }); err != nil {
+		return err
+	}
+	if p.Info == nil {
+		return nil
+	}
+	if err := updatePhotoPrism(ctx, p.UID, api.FormPhoto{Favorite: &on}); err != nil {
+		return err
+	}
+	p.Info.Favorite = &on
+	return nil
+}
+
+// SetRating gives the photo a rating from 1 to 5, 0 clears it
+func SetRating(ctx context.Context, p *Photo, rating int) error {
+	if _, err := overrides.Update(p.UID, func(o *overrides.Override) { o.Rating = rating }); err != nil {
+		return err
+	}
+	if p.Info == nil {
+		return nil
+	}
+	// Take off the old rating before adding the new one
+	if p.Info.Labels != nil {
+		for _, l := range *p.Info.Labels {
+			if l.Label == nil || l.LabelID == nil || !strings.HasPrefix(deref(l.Label.Name), ratingLabel) {
+				continue
+			}
+			path := fmt.Sprintf("/api/v1/photos/%s/label/%d", p.UID, *l.LabelID)
+			if err := photoprismDo(ctx, http.MethodDelete, path, nil, nil, nil); err != nil {
+				return fmt.Errorf("removing %s: %v", deref(l.Label.Name), err)
+			}
+		}
+	}
+	if rating == 0 {
+		return nil
+	}
+	name, uncertainty := fmt.Sprintf("%s%d", ratingLabel, rating), 0
+	label := api.FormLabel{Name: &name, Uncertainty: &uncertainty}
+	var updated api.EntityPhoto
+	if err := photoprismDo(ctx, http.MethodPost, "/api/v1/photos/"+p.UID+"/label", nil, label, &updated); err != nil {
+		return fmt.Errorf("labelling %s: %v", name, err)
+	}
+	p.Info.Labels = updated.Labels
+	return nil
+}
+
+// How photos are hidden in PhotoPrism, HIDE_MODE is archive (default) or
+// private.  Private photos are then left out of the slideshow.
+func hideMode() string {
+	if strings.EqualFold(os.Getenv("HIDE_MODE"), "private") {
+		return "private"
+	}
+	return "archive"
+}
+
+// Hide makes sure the photo is never shown again
+func Hide(ctx context.Context, p *Photo) error {
+	if _, err := overrides.Update(p.UID, func(o *overrides.Override) { o.Hidden = true }); err != nil {
+		return err
+	}
+	if p.Info == nil {
+		return nil
+	}
+	if hideMode() == "private" {
+		private := true
+		return updatePhotoPrism(ctx, p.UID, api.FormPhoto{Private: &private})
+	}
+	selection := api.FormSelection{Photos: &[]string{p.UID}}
+	if err := photoprismDo(ctx, http.MethodPost, "/api/v1/batch/photos/archive", nil, selection, nil); err != nil {
+		return fmt.Errorf("archiving: %v", err)
+	}
+	log.Printf("Archived %s in PhotoPrism", p.UID)
+	return nil
+}
+
+// Changes the details of a photo in PhotoPrism
+func updatePhotoPrism(ctx context.Context, uid string, form api.FormPhoto) error {
+	if err := photoprismDo(ctx, http.MethodPut, "/api/v1/photos/"+uid, nil, form, nil); err != nil {
+		return fmt.Errorf("updating %s: %v", uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// A photo to show along with what is known about it
+
+package frame
+
+import (
+	"encoding/json"
+	"image"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/drawing"
+	"github.com/drummonds/gophoto/internal/meta"
+	"github.com/drummonds/photoprism-go-api/api"
+)
+
+// Default for the largest fraction of a photo that fill mode is allowed to crop
+// away before falling back to fit
+const DefaultMaxCrop = 0.3
+
+// Extra room kept around a face when cropping, as a fraction of the face
+// size, so that hair and chins survive.
+const (
+	faceHeadroom = 0.5
+	faceMargin   = 0.25
+)
+
+type Photo struct {
+	UID     string
+	Image   image.Image      // Orientated but not scaled
+	Info    *api.EntityPhoto // Details from PhotoPrism, nil if not from PhotoPrism
+	Markers []Marker         // Faces and other regions of interest
+	Meta    meta.Info        // For the caption
+}
+
+// A PhotoPrism marker.  The position and size are relative to the size of
+// the orientated image so 0.5 is half way across.
+type Marker struct {
+	Type    string // "face" or the kind of subject
+	Name    string // Name of the person if known
+	Invalid bool
+	X, Y    float64
+	W, H    float64
+}
+
+// Rect converts the relative marker into pixels of an image with bounds b.
+func (m Marker) Rect(b image.Rectangle) image.Rectangle {
+	w, h := float64(b.Dx()), float64(b.Dy())
+	return image.Rect(
+		b.Min.X+int(m.X*w), b.Min.Y+int(m.Y*h),
+		b.Min.X+int((m.X+m.W)*w), b.Min.Y+int((m.Y+m.H)*h),
+	).Intersect(b)
+}
+
+// Describes the photo from what PhotoPrism knows about it, anything missing is
+// filled from the file's own EXIF and XMP.
+func photoMeta(info *api.EntityPhoto, markers []Marker, file meta.Info) meta.Info {
+	var m meta.Info
+	if info != nil {
+		m.Title = deref(info.Title)
+		m.Description = deref(info.Description)
+		// PhotoPrism marks local time as UTC
+		if t, err := time.ParseInLocation("2006-01-02T15:04:05Z", deref(info.TakenAtLocal), time.Local); err == nil {
+			m.Taken = t
+		}
+		if info.Place != nil && deref(info.PlaceID) != "zz" { // zz is unknown
+			m.Place = deref(info.Place.Label)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, marker := range markers {
+		name := strings.TrimSpace(marker.Name)
+		if marker.Type == "face" && !marker.Invalid && name != "" && !seen[name] {
+			seen[name] = true
+			m.People = append(m.People, name)
+		}
+	}
+	return m.Merge(file)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// The generated API doesn't include the markers so they are read from the
+// raw response.
+func parseMarkers(body []byte) ([]Marker, error) {
+	var raw struct {
+		Files []struct {
+			Primary bool
+			Markers []Marker
+		}
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	var markers []Marker
+	for _, f := range raw.Files {
+		if !f.Primary && len(raw.Files) > 1 {
+			continue
+		}
+		for _, m := range f.Markers {
+			if !m.Invalid && m.W > 0 && m.H > 0 {
+				markers = append(markers, m)
+			}
+		}
+	}
+	return markers, nil
+}
+
+// Interest returns the area of the photo covering all the faces and subjects,
+// with some room around faces.  It is empty when there are no markers.
+func (p *Photo) Interest() image.Rectangle {
+	b := p.Image.Bounds()
+	var interest image.Rectangle
+	for _, m := range p.Markers {
+		r := m.Rect(b)
+		if m.Type == "face" {
+			mx := int(float64(r.Dx()) * faceMargin)
+			r = image.Rect(r.Min.X-mx, r.Min.Y-int(float64(r.Dy())*faceHeadroom), r.Max.X+mx, r.Max.Y+int(float64(r.Dy())*faceMargin))
+		}
+		interest = interest.Union(r.Intersect(b))
+	}
+	return interest
+}
+
+// FillCrop works out which part of the photo to show when filling a screen of
+// the given size.  Faces and subjects are kept in view when PhotoPrism knows
+// about them, otherwise the busiest part of the photo is used.
+func (p *Photo) FillCrop(target image.Point) image.Rectangle {
+	if interest := p.Interest(); !interest.Empty() {
+		return drawing.CropWindow(p.Image.Bounds(), target, interest)
+	}
+	return drawing.SalientCrop(p.Image, target)
+}
+
+// ScalePhoto scales a photo to the bounds using the page settings.  In fill
+// mode the photo is cropped around its subject unless that would lose more
+// than MaxCrop of it, in which case it is fitted on a blurred background.
+func ScalePhoto(p *Photo, bounds image.Rectangle) image.Image {
+	if !GlobalPage.Fill {
+		return ScaleImageOnBackground(p.Image, bounds, true, GlobalPage.Background, DefaultBGColour)
+	}
+	crop := p.FillCrop(bounds.Size())
+	if fraction := drawing.CropFraction(p.Image.Bounds(), crop); fraction > GlobalPage.MaxCrop {
+		log.Printf("Fill would crop %.0f%% of %s, fitting instead", fraction*100, p.UID)
+		return ScaleImageOnBackground(p.Image, bounds, true, BackgroundBlur, DefaultBGColour)
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	drawing.Scale(scaled, scaled.Bounds(), p.Image, crop)
+	return scaled
+}
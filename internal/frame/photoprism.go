@@ -4,18 +4,26 @@ package frame
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/disintegration/gift"
+	"github.com/drummonds/gophoto/internal/audience"
 	"github.com/drummonds/gophoto/internal/drawing"
+	"github.com/drummonds/gophoto/internal/meta"
+	"github.com/drummonds/gophoto/internal/overrides"
 	"github.com/drummonds/gophoto/internal/panel"
+	"github.com/drummonds/gophoto/internal/settings"
 	"github.com/drummonds/photoprism-go-api/api"
-	"golang.org/x/image/draw"
 )
 
 type Page struct {
@@ -25,6 +33,9 @@ type Page struct {
 	Clock      string
 	PhotoIndex int
 	Client     *api.ClientWithResponses
+	Background BackgroundMode // How the bars around a fitted photo are filled
+	Fill       bool           // Crop photos to fill the screen rather than fit inside it
+	MaxCrop    float64        // Largest fraction of a photo that fill may crop away
 }
 
 var (
@@ -44,10 +55,29 @@ func GetClient() (*api.ClientWithResponses, error) {
 
 // Scale and image to centre and fit or fill
 func ScaleImage(img image.Image, dstBounds image.Rectangle, fit bool) image.Image {
+	scaled := image.NewRGBA(image.Rect(0, 0, dstBounds.Dx(), dstBounds.Dy()))
+	scaleInto(scaled, img, fit)
+	return scaled
+}
+
+// Scale an image to centre and fit or fill.  When fitting the bars either side
+// are painted according to the background mode, bg is used for the plain
+// background.
+func ScaleImageOnBackground(img image.Image, dstBounds image.Rectangle, fit bool, mode BackgroundMode, bg color.RGBA) image.Image {
+	scaled := image.NewRGBA(image.Rect(0, 0, dstBounds.Dx(), dstBounds.Dy()))
+	if fit {
+		PaintBackground(scaled, img, mode, bg)
+	}
+	scaleInto(scaled, img, fit)
+	return scaled
+}
+
+// Scale img into the centre of scaled
+func scaleInto(scaled *image.RGBA, img image.Image, fit bool) {
 	// Calculate scaling factors
 	srcBounds := img.Bounds()
-	windowWidth := dstBounds.Dx()
-	windowHeight := dstBounds.Dy()
+	windowWidth := scaled.Bounds().Dx()
+	windowHeight := scaled.Bounds().Dy()
 	srcAspect := float64(srcBounds.Dx()) / float64(srcBounds.Dy())
 	dstAspect := float64(windowWidth) / float64(windowHeight)
 
@@ -69,79 +99,267 @@ func ScaleImage(img image.Image, dstBounds image.Rectangle, fit bool) image.Imag
 			scaledWidth = int(float64(windowHeight) * srcAspect)
 		}
 	}
-	// Create a new RGBA image with the window dimensions
-	scaled := image.NewRGBA(image.Rect(0, 0, windowWidth, windowHeight))
-
 	// Calculate offset for centering
 	offsetX := (windowWidth - scaledWidth) / 2
 	offsetY := (windowHeight - scaledHeight) / 2
 
-	// Scale and center the image
-	draw.CatmullRom.Scale(scaled,
+	// Scale and center the image, using all the cores
+	drawing.Scale(scaled,
 		image.Rect(offsetX, offsetY, offsetX+scaledWidth, offsetY+scaledHeight),
-		img, srcBounds, draw.Over, nil)
-
-	return scaled
+		img, srcBounds)
 }
 
 func NewImage(ctx context.Context, bounds image.Rectangle) (image.Image, error) {
-	log.Printf("Start newImage get and wait 3 sec")
-	time.Sleep(3 * time.Second)
-	rawImg, err := GetImage(ctx)
+	photo, err := NewPhoto(ctx)
 	if err != nil {
-		return rawImg, err
+		return nil, err
 	}
-	log.Printf("got raw image")
 	// handle scaling to mock frame buffer
-	img := ScaleImage(rawImg, bounds, true)
+	img := ScalePhoto(photo, bounds)
 	log.Printf("Scaled image")
 	return img, err
 }
 
+// Gets the next photo, unscaled so it can be shown with its details.  It is
+// called from the event loop so it never waits for one to be queued.
+func NewPhoto(ctx context.Context) (*Photo, error) {
+	photo, err := GetPhoto(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("got raw image")
+	return photo, nil
+}
+
 // Fill channels with photo ids.  Keep going until context is cancelled
 // use channel to slow down the process
-// Once album is exhausted it restarts at the begining
-func FillPhotoIDChan(ctx context.Context) {
-	var albumUid string
-	albumUid = os.Getenv("ALBUM_UID")
-	log.Printf("FillPhotoIDChan start filling photo chan for album %s", albumUid)
+// Once the playlist is exhausted it restarts at the begining.  Each album,
+// label and person in the playlist takes turns to give a page of photos.
+// Only photos the audience may see are sent.  When PhotoPrism can't be
+// reached it tries again, waiting longer each time up to maxBackoff.
+func FillPhotoIDChan(ctx context.Context, playlist settings.Playlist, aud audience.Audience) {
+	log.Printf("FillPhotoIDChan start filling photo chan for %+v shown to %q", playlist, aud.Name)
 
-	offset := 0
-	statusErrorCount := 0
-out:
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Done filling photo id chan")
-			break out
-		default:
-			// Get photos from album
-			photoParams := api.SearchPhotosParams{Count: 20, Offset: &offset, S: &albumUid}
-			photos, err := GlobalPage.Client.SearchPhotosWithResponse(ctx, &photoParams)
-			if err != nil {
-				log.Printf("Error getting photos %v", err)
-				break out
+	queries := playlistQueries(playlist, aud)
+	offsets := make([]int, len(queries))
+	wrapped := make([]bool, len(queries)) // Queries that have started again this pass
+	sent := 0                             // Photos this pass
+	var backoff time.Duration
+	retry := func(err error) bool {
+		backoff = min(max(2*backoff, minBackoff), maxBackoff)
+		log.Printf("Error getting photos, trying again in %v: %v", backoff, err)
+		return sleep(ctx, backoff)
+	}
+	idx, idxErr := audienceIndex(ctx, aud)
+	for i := 0; ctx.Err() == nil; i = (i + 1) % len(queries) {
+		if idxErr != nil {
+			// Without the index the audience's rules can't be kept
+			log.Printf("Can't find photos for audience %q: %v", aud.Name, idxErr)
+			if !sleep(ctx, time.Minute) {
+				break
 			}
-			if photos.HTTPResponse.StatusCode != 200 {
-				statusErrorCount++
-				if statusErrorCount > 10 {
-					log.Printf("Return 10 HTTP errors so exit")
-					break out
-				}
-			} else {
-				statusErrorCount = 0
-				for _, photo := range *photos.JSON200 {
-					GlobalPhotoIDChan <- *photo.UID // implicit wait
-				}
-				if len(*photos.JSON200) < 20 {
-					offset = 0 // Start again from begining
-				} else {
-					offset += 20
+			idx, idxErr = audienceIndex(ctx, aud)
+			continue
+		}
+		// Get photos from album
+		photoParams := queries[i]
+		photoParams.Offset = &offsets[i]
+		photos, err := GlobalPage.Client.SearchPhotosWithResponse(ctx, &photoParams)
+		if err == nil && photos.JSON200 == nil {
+			err = fmt.Errorf("search: %s", photos.HTTPResponse.Status)
+		}
+		if err != nil {
+			if !retry(err) {
+				break
+			}
+			continue
+		}
+		backoff = 0
+		for _, photo := range *photos.JSON200 {
+			if !aud.Allows(audiencePhoto(photo), idx) {
+				continue
+			}
+			select {
+			case GlobalPhotoIDChan <- *photo.UID: // implicit wait
+				sent++
+			case <-ctx.Done():
+				log.Println("Done filling photo id chan")
+				return
+			}
+		}
+		if len(*photos.JSON200) < photoParams.Count {
+			offsets[i] = 0 // Start again from begining
+			wrapped[i] = true
+		} else {
+			offsets[i] += photoParams.Count
+		}
+		if !slices.Contains(wrapped, false) {
+			// Been through everything, albums and labels may have changed since
+			if sent == 0 {
+				log.Printf("No photos in %+v for audience %q", playlist, aud.Name)
+				if !sleep(ctx, time.Minute) {
+					break
 				}
 			}
+			clear(wrapped)
+			sent = 0
+			idx, idxErr = audienceIndex(ctx, aud)
+		}
+	}
+	log.Println("Done filling photo id chan")
+}
+
+// How long to wait before asking PhotoPrism again after an error
+const minBackoff, maxBackoff = 5 * time.Second, 5 * time.Minute
+
+// Waits unless ctx is cancelled first, when it gives false
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// A search for each source of photos in the playlist, or one for all photos
+// if it is empty.  An empty playlist with an audience that only sees some
+// albums, labels or people searches just those.
+func playlistQueries(playlist settings.Playlist, aud audience.Audience) []api.SearchPhotosParams {
+	if playlist.Empty() {
+		playlist = settings.Playlist{Albums: aud.Include.Albums, Labels: aud.Include.Labels, People: aud.Include.People}
+	}
+	var queries []api.SearchPhotosParams
+	for _, album := range playlist.Albums {
+		queries = append(queries, api.SearchPhotosParams{Count: 20, S: &album})
+	}
+	for _, label := range playlist.Labels {
+		q := "label:" + label
+		queries = append(queries, api.SearchPhotosParams{Count: 20, Q: &q})
+	}
+	for _, person := range playlist.People {
+		q := "subject:" + person
+		queries = append(queries, api.SearchPhotosParams{Count: 20, Q: &q})
+	}
+	if len(queries) == 0 {
+		queries = append(queries, api.SearchPhotosParams{Count: 20})
+	}
+	if hideMode() == "private" || aud.Exclude.Private {
+		public := true // Leave out the hidden photos
+		for i := range queries {
+			queries[i].Public = &public
 		}
 	}
-	close(GlobalPhotoIDChan)
+	return queries
+}
+
+// What the audience rules need to know about a photo from a search
+func audiencePhoto(photo api.SearchPhoto) audience.Photo {
+	p := audience.Photo{UID: deref(photo.UID)}
+	if photo.Private != nil {
+		p.Private = *photo.Private
+	}
+	// PhotoPrism marks local time as UTC
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05Z", deref(photo.TakenAtLocal), time.Local); err == nil {
+		p.Taken = t
+	}
+	return p
+}
+
+// Finds the photos in the albums, with the labels and of the people the
+// audience's rules mention
+func audienceIndex(ctx context.Context, aud audience.Audience) (audience.Index, error) {
+	var idx audience.Index
+	albums, labels, people := aud.Sources()
+	var err error
+	if idx.Albums, err = sourcePhotos(ctx, albums, func(album string) api.SearchPhotosParams {
+		return api.SearchPhotosParams{S: &album}
+	}); err != nil {
+		return idx, err
+	}
+	if idx.Labels, err = sourcePhotos(ctx, labels, func(label string) api.SearchPhotosParams {
+		q := "label:" + label
+		return api.SearchPhotosParams{Q: &q}
+	}); err != nil {
+		return idx, err
+	}
+	idx.People, err = sourcePhotos(ctx, people, func(person string) api.SearchPhotosParams {
+		q := "subject:" + person
+		return api.SearchPhotosParams{Q: &q}
+	})
+	return idx, err
+}
+
+// The UIDs of all the photos in each source
+func sourcePhotos(ctx context.Context, sources []string, search func(string) api.SearchPhotosParams) (map[string]map[string]bool, error) {
+	const page = 500
+	sets := make(map[string]map[string]bool)
+	for _, source := range sources {
+		if sets[source] != nil {
+			continue
+		}
+		set := make(map[string]bool)
+		for offset := 0; ; offset += page {
+			params := search(source)
+			params.Count, params.Offset = page, &offset
+			photos, err := GlobalPage.Client.SearchPhotosWithResponse(ctx, &params)
+			if err != nil {
+				return nil, err
+			}
+			if photos.JSON200 == nil {
+				return nil, fmt.Errorf("searching %s: %s", source, photos.HTTPResponse.Status)
+			}
+			for _, photo := range *photos.JSON200 {
+				set[deref(photo.UID)] = true
+			}
+			if len(*photos.JSON200) < page {
+				break
+			}
+		}
+		sets[source] = set
+	}
+	return sets, nil
+}
+
+// The goroutine filling GlobalPhotoIDChan
+var filling struct {
+	sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// SetPlaylist changes where photos come from and who they are for.  Photos
+// already queued from the old playlist are dropped so the new one shows
+// straight away.
+func SetPlaylist(ctx context.Context, playlist settings.Playlist, aud audience.Audience) {
+	filling.Lock()
+	defer filling.Unlock()
+	stopFilling()
+	ctx, filling.cancel = context.WithCancel(ctx)
+	filling.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		FillPhotoIDChan(ctx, playlist, aud)
+	}(filling.done)
+}
+
+// StopPlaylist stops looking for photos, eg while nobody can see them, until
+// SetPlaylist is called again
+func StopPlaylist() {
+	filling.Lock()
+	defer filling.Unlock()
+	stopFilling()
+}
+
+func stopFilling() {
+	if filling.cancel != nil {
+		filling.cancel()
+		<-filling.done
+		filling.cancel = nil
+	}
+	for len(GlobalPhotoIDChan) > 0 {
+		<-GlobalPhotoIDChan
+	}
 }
 
 // Search for first album
@@ -172,26 +390,52 @@ func GetPhotoList(ctx context.Context) ([]string, error) {
 	return photoList, nil
 }
 
-func firstJpeg(files []api.EntityFile) api.EntityFile {
+// The first JPEG file that can be downloaded, false if there is none
+func firstJpeg(files []api.EntityFile) (api.EntityFile, bool) {
 	for _, file := range files {
-		if *file.Mime == "image/jpeg" {
-			return file
+		if file.Mime != nil && *file.Mime == "image/jpeg" && file.Hash != nil {
+			return file, true
 		}
 	}
-	return api.EntityFile{}
+	return api.EntityFile{}, false
 }
 
-// Returns a raw image, orientated correctly but not scaled
-func GetImage(ctx context.Context) (image.Image, error) {
+// ErrNoPhotoQueued is returned by GetPhoto when no photo has been found yet,
+// eg while PhotoPrism can't be reached
+var ErrNoPhotoQueued = errors.New("no photo queued yet")
+
+// Returns the next photo with a raw image, orientated correctly but not
+// scaled.  It doesn't wait for one to be queued, so the slideshow carries on
+// responding while there are none.
+func GetPhoto(ctx context.Context) (*Photo, error) {
+	log.Printf("GetPhoto")
+	// Get photo Id
+	// uid := GlobalPhotoList[GlobalPage.PhotoIndex]
+	for {
+		select {
+		case uid := <-GlobalPhotoIDChan:
+			if overrides.Hidden(uid) {
+				continue
+			}
+			return GetPhotoByUID(ctx, uid)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			return nil, ErrNoPhotoQueued
+		}
+	}
+}
+
+// Returns the photo uid with a raw image, orientated correctly but not scaled
+func GetPhotoByUID(ctx context.Context, uid string) (*Photo, error) {
 	var (
 		body        []byte
 		orientation int
-		blank       image.Image
+		blank       *Photo
 	)
-	log.Printf("GetImage")
-	// Get photo Id
-	// uid := GlobalPhotoList[GlobalPage.PhotoIndex]
-	uid := <-GlobalPhotoIDChan
+	if overrides.Hidden(uid) {
+		return blank, fmt.Errorf("photo %s is hidden", uid)
+	}
 	// Get details by search
 	// SearchPhotosWithResponse(ctx context.Context, params *SearchPhotosParams, reqEditors ...RequestEditorFn) (*SearchPhotosResponse, error)
 
@@ -200,41 +444,50 @@ func GetImage(ctx context.Context) (image.Image, error) {
 	if err != nil {
 		return blank, err
 	}
+	if photo.StatusCode() != 200 || photo.JSON200 == nil {
+		return blank, fmt.Errorf("Problem with status getting photo %s %v", uid, photo.StatusCode())
+	}
 	log.Printf("Got photo")
-	files := photo.JSON200.Files
-	log.Printf("Got files %v", len(*files))
-	if len(*files) > 0 {
-		fileEntity := firstJpeg(*files)
+	var files []api.EntityFile
+	if photo.JSON200.Files != nil {
+		files = *photo.JSON200.Files
+	}
+	log.Printf("Got files %v", len(files))
+	fileEntity, ok := firstJpeg(files)
+	if !ok {
+		return blank, fmt.Errorf("photo %s has no JPEG to download", uid)
+	}
+	if fileEntity.Orientation != nil {
 		orientation = *fileEntity.Orientation
-		switch {
-		case true: // Download raw file
-			// now get actual data
-			hash := *fileEntity.Hash
-			// hash := GlobalPhotoList[GlobalPage.PhotoIndex]
-			log.Printf("Get download")
-
-			file, err := GlobalPage.Client.GetDownloadWithResponse(ctx, hash)
-			if err != nil {
-				return blank, err
-			}
-			status := file.HTTPResponse.StatusCode
-			if status != 200 {
-				return blank, fmt.Errorf("Problem with status downloading file %v\n", file.HTTPResponse.StatusCode)
-			}
-			body = file.Body
-		case true: // Download thumbnail
-			hash := *fileEntity.Hash
-			token := os.Getenv("PHOTOPRISM_TOKEN")
-			file, err := GlobalPage.Client.GetThumbWithResponse(ctx, hash, token, "tile_500")
-			if err != nil {
-				return blank, err
-			}
-			status := file.HTTPResponse.StatusCode
-			if status != 200 {
-				return blank, fmt.Errorf("Problem with status downloading file %v\n", file.HTTPResponse.StatusCode)
-			}
-			body = file.Body
+	}
+	switch {
+	case true: // Download raw file
+		// now get actual data
+		hash := *fileEntity.Hash
+		// hash := GlobalPhotoList[GlobalPage.PhotoIndex]
+		log.Printf("Get download")
+
+		file, err := GlobalPage.Client.GetDownloadWithResponse(ctx, hash)
+		if err != nil {
+			return blank, err
+		}
+		status := file.HTTPResponse.StatusCode
+		if status != 200 {
+			return blank, fmt.Errorf("Problem with status downloading file %v\n", file.HTTPResponse.StatusCode)
 		}
+		body = file.Body
+	case true: // Download thumbnail
+		hash := *fileEntity.Hash
+		token := os.Getenv("PHOTOPRISM_TOKEN")
+		file, err := GlobalPage.Client.GetThumbWithResponse(ctx, hash, token, "tile_500")
+		if err != nil {
+			return blank, err
+		}
+		status := file.HTTPResponse.StatusCode
+		if status != 200 {
+			return blank, fmt.Errorf("Problem with status downloading file %v\n", file.HTTPResponse.StatusCode)
+		}
+		body = file.Body
 	}
 	// Decode the test image using the imageorient.Decode function
 	// to handle the image orientation correctly.
@@ -278,7 +531,40 @@ func GetImage(ctx context.Context) (image.Image, error) {
 	log.Printf("Drawn")
 
 	// Use 'oriented' for further processing
-	return oriented, nil
+	markers, err := parseMarkers(photo.Body)
+	if err != nil {
+		log.Printf("Can't read markers for %s: %v", uid, err)
+	}
+	fileMeta, err := meta.ReadJPEG(body)
+	if err != nil {
+		log.Printf("Can't read metadata for %s: %v", uid, err)
+	}
+	return &Photo{
+		UID:     uid,
+		Image:   oriented,
+		Info:    photo.JSON200,
+		Markers: markers,
+		Meta:    photoMeta(photo.JSON200, markers, fileMeta),
+	}, nil
+}
+
+// Read how photos are to be scaled from the environment
+func loadScaleSettings() {
+	var err error
+	GlobalPage.Background, err = ParseBackgroundMode(os.Getenv("BACKGROUND_MODE"))
+	if err != nil {
+		log.Printf("%v, using plain background", err)
+	}
+	GlobalPage.Fill = settings.Current().Fit == "fill"
+	GlobalPage.MaxCrop = DefaultMaxCrop
+	if s := os.Getenv("MAX_CROP"); s != "" {
+		percent, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			log.Printf("Bad MAX_CROP %q: %v", s, err)
+		} else {
+			GlobalPage.MaxCrop = percent / 100
+		}
+	}
 }
 
 // Setup pictures to pull
@@ -288,9 +574,10 @@ func NewPhotoPrism(ctx context.Context) (err error) {
 	if err != nil {
 		return err
 	}
+	loadScaleSettings()
 	log.Printf("Get photolist %s\n", time.Now().Format(time.RFC3339))
 	// GlobalPhotoList, err = GetPhotoList(ctx)  // only 20
-	go FillPhotoIDChan(ctx)
+	SetPlaylist(ctx, settings.Current().Playlist, settings.Current().ActiveAudience())
 	log.Printf("Got photolist %s, err = %+v\n", time.Now().Format(time.RFC3339), err)
 	return err
 }
@@ -0,0 +1,112 @@
+package frame
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/overrides"
+)
+
+// Serves photos from a pretend PhotoPrism, noting which were asked for
+func fakePhotoPrism(t *testing.T) *[]string {
+	var asked []string
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 4, 3)), nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if uid, ok := strings.CutPrefix(r.URL.Path, "/api/v1/photos/"); ok {
+			asked = append(asked, uid)
+			w.Header().Set("Content-Type", "application/json")
+			switch uid {
+			case "unknown":
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": "Photo not found"}`))
+			case "video":
+				w.Write([]byte(`{"UID": "video", "Files": [{"Hash": "hvideo", "Mime": "video/mp4"}]}`))
+			case "unfinished":
+				w.Write([]byte(`{"UID": "unfinished", "Files": [{"Mime": "image/jpeg"}]}`))
+			default:
+				w.Write([]byte(`{"UID": "` + uid + `", "Files": [{"Hash": "h` + uid + `", "Mime": "image/jpeg", "Orientation": 1}]}`))
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(photo.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("PHOTOPRISM_DOMAIN", server.URL)
+	client, err := GetClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := GlobalPage.Client
+	GlobalPage.Client = client
+	t.Cleanup(func() { GlobalPage.Client = old })
+	return &asked
+}
+
+func TestHiddenNeverShown(t *testing.T) {
+	t.Setenv("OVERRIDES_FILE", filepath.Join(t.TempDir(), "overrides.json"))
+	overrides.Load()
+	if _, err := overrides.Update("hidden", func(o *overrides.Override) { o.Hidden = true }); err != nil {
+		t.Fatal(err)
+	}
+	asked := fakePhotoPrism(t)
+	ctx := context.Background()
+
+	GlobalPhotoIDChan <- "hidden"
+	GlobalPhotoIDChan <- "shown"
+	photo, err := GetPhoto(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photo.UID != "shown" {
+		t.Errorf("got %s, want the one after the hidden photo", photo.UID)
+	}
+
+	// Hidden after being queued, as when hidden from the remote
+	GlobalPhotoIDChan <- "later"
+	Hide(ctx, &Photo{UID: "later"})
+	if _, err := GetPhoto(ctx); !errors.Is(err, ErrNoPhotoQueued) {
+		t.Errorf("got %v with only hidden photos queued, want %v", err, ErrNoPhotoQueued)
+	}
+	if _, err := GetPhotoByUID(ctx, "hidden"); err == nil {
+		t.Error("got a hidden photo by asking for it")
+	}
+	if want := []string{"shown"}; !slices.Equal(*asked, want) {
+		t.Errorf("asked PhotoPrism for %v, want only %v", *asked, want)
+	}
+}
+
+func TestGetPhotoByUIDFails(t *testing.T) {
+	fakePhotoPrism(t)
+	for _, uid := range []string{"unknown", "video", "unfinished"} {
+		if photo, err := GetPhotoByUID(context.Background(), uid); err == nil {
+			t.Errorf("got %v for %s, want an error", photo, uid)
+		}
+	}
+}
+
+func TestNewPhotoDoesntWait(t *testing.T) {
+	fakePhotoPrism(t)
+	start := time.Now()
+	if _, err := NewPhoto(context.Background()); !errors.Is(err, ErrNoPhotoQueued) {
+		t.Errorf("got %v with nothing queued, want %v", err, ErrNoPhotoQueued)
+	}
+	GlobalPhotoIDChan <- "queued"
+	if photo, err := NewPhoto(context.Background()); err != nil || photo.UID != "queued" {
+		t.Errorf("got %v %v, want the queued photo", photo, err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("took %v, holding up the event loop", took)
+	}
+}
@@ -3,15 +3,11 @@
 package frame
 
 import (
-	"bytes"
-	"image"
+	"context"
 	"log"
 
 	_ "embed"
 	_ "image/png"
-
-	"github.com/drummonds/gophoto/internal/drawing"
-	"github.com/drummonds/gophoto/internal/panel"
 )
 
 // gokrazy
@@ -19,36 +15,24 @@ import (
 //go:embed "P1120981.png"
 var displayPhotoPNG []byte
 
-func (pf *PictureFrame) SetupBoundedStaticImage() {
-	borderTop := 30
-	margin := 20
-	// get the main image
-	displayPhoto, _, err := image.Decode(bytes.NewReader(displayPhotoPNG))
+// Builds the frame from one of the built in layouts
+func (pf *PictureFrame) setupBuiltinLayout(name string) {
+	layout, err := LoadLayout(name)
 	if err != nil {
-		panic("Can't find photo")
+		panic(err)
+	}
+	if err := pf.ApplyLayout(context.Background(), layout); err != nil {
+		panic(err)
+	}
+	for _, p := range pf.panels {
+		log.Printf("Panel %T location - %v", p.widget, p.rect)
 	}
-	picture := panel.NewImagePanel(displayPhoto)
-	// picture.Resize ( pf.Bounds.Max.X-margin*2, pf.Bounds.Max.Y-borderTop-margin*2,
-	photoRect := drawing.ScaleImageInside(displayPhoto.Bounds(), pf.Bounds.Max.X-margin*2, pf.Bounds.Max.Y-borderTop-margin*2)
-	// Now move image to center
-	padX := margin + (pf.Bounds.Max.X-photoRect.Size().X)/2
-	padY := borderTop + ((pf.Bounds.Max.X-borderTop)-photoRect.Size().Y)/2
-	picture.Location = photoRect.Add(image.Point{padX, padY})
-	pf.AddPanel(picture)
-	// pf.SetBGColour(0xF4, 0xC7, 0xDF)
-	log.Printf("Picture location - %v", picture.Location)
+}
+
+func (pf *PictureFrame) SetupBoundedStaticImage() {
+	pf.setupBuiltinLayout("bounded")
 }
 
 func (pf *PictureFrame) SetupFullStaticImage() {
-	// get the main image
-	displayPhoto, _, err := image.Decode(bytes.NewReader(displayPhotoPNG))
-	if err != nil {
-		panic("Can't find photo")
-	}
-	picture := panel.NewImagePanel(displayPhoto)
-	photoRect := drawing.ScaleImageOuter(displayPhoto.Bounds(), pf.Bounds.Size(), image.Point{0, 0})
-	// Now move image to center
-	picture.Location = photoRect
-	pf.AddPanel(picture)
-	log.Printf("Picture location - %v", picture.Location)
+	pf.setupBuiltinLayout("full")
 }
@@ -0,0 +1,238 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// JPEG markers
+const (
+	markerSOI  = 0xd8
+	markerSOS  = 0xda
+	markerAPP1 = 0xe1
+)
+
+// EXIF tags that are read
+const (
+	tagImageDescription = 0x010e
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// ReadJPEG reads the EXIF and XMP metadata from the start of a JPEG file.
+// XMP takes precedence as it is what photo managers write to.
+func ReadJPEG(data []byte) (Info, error) {
+	var exif, xmp Info
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return Info{}, errors.New("not a JPEG")
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return Info{}, errors.New("corrupt JPEG segment")
+		}
+		marker := data[pos+1]
+		if marker == 0xff { // Padding
+			pos++
+			continue
+		}
+		if marker == markerSOS {
+			break // Image data follows
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return Info{}, errors.New("truncated JPEG segment")
+		}
+		segment := data[pos+4 : end]
+		if marker == markerAPP1 {
+			switch {
+			case bytes.HasPrefix(segment, exifHeader):
+				var err error
+				exif, err = readExif(segment[len(exifHeader):])
+				if err != nil {
+					return Info{}, err
+				}
+			case bytes.HasPrefix(segment, xmpHeader):
+				xmp = readXMP(string(segment[len(xmpHeader):]))
+			}
+		}
+		pos = end
+	}
+	return xmp.Merge(exif), nil
+}
+
+// Reads the few tags wanted from a TIFF structure
+func readExif(tiff []byte) (Info, error) {
+	var info Info
+	if len(tiff) < 8 {
+		return info, errors.New("short EXIF")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info, errors.New("bad EXIF byte order")
+	}
+	tags := make(map[uint16]ifdEntry)
+	readIFD(tiff, order, order.Uint32(tiff[4:]), tags)
+	if e, ok := tags[tagExifIFD]; ok {
+		readIFD(tiff, order, e.uint(tiff, order), tags)
+	}
+
+	info.Description = strings.TrimSpace(tags[tagImageDescription].string(tiff, order))
+	if e, ok := tags[tagOrientation]; ok {
+		info.Orientation = int(e.uint(tiff, order))
+	}
+	if s := tags[tagDateTimeOriginal].string(tiff, order); s != "" {
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local); err == nil {
+			info.Taken = t
+		}
+	}
+	return info, nil
+}
+
+type ifdEntry struct {
+	typ    uint16
+	count  uint32
+	offset uint32 // Position of the value in the TIFF data
+}
+
+// Collects the entries of an IFD, ignoring anything out of range
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32, tags map[uint16]ifdEntry) {
+	if int(offset)+2 > len(tiff) {
+		return
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < n; i++ {
+		pos := int(offset) + 2 + 12*i
+		if pos+12 > len(tiff) {
+			return
+		}
+		e := ifdEntry{
+			typ:    order.Uint16(tiff[pos+2:]),
+			count:  order.Uint32(tiff[pos+4:]),
+			offset: uint32(pos + 8),
+		}
+		if e.size() > 4 { // Value is elsewhere
+			e.offset = order.Uint32(tiff[pos+8:])
+		}
+		tags[order.Uint16(tiff[pos:])] = e
+	}
+}
+
+func (e ifdEntry) size() int {
+	switch e.typ {
+	case 3: // SHORT
+		return 2 * int(e.count)
+	case 4: // LONG
+		return 4 * int(e.count)
+	}
+	return int(e.count)
+}
+
+func (e ifdEntry) uint(tiff []byte, order binary.ByteOrder) uint32 {
+	if int(e.offset)+e.size() > len(tiff) || e.count == 0 {
+		return 0
+	}
+	switch e.typ {
+	case 3:
+		return uint32(order.Uint16(tiff[e.offset:]))
+	case 4:
+		return order.Uint32(tiff[e.offset:])
+	}
+	return 0
+}
+
+func (e ifdEntry) string(tiff []byte, order binary.ByteOrder) string {
+	if e.typ != 2 || int(e.offset)+e.size() > len(tiff) {
+		return ""
+	}
+	s := tiff[e.offset : int(e.offset)+e.size()]
+	return string(bytes.TrimRight(s, "\x00"))
+}
+
+// XMP is read with patterns rather than a full RDF parser as the properties
+// can be written either as attributes or elements.
+func readXMP(xmp string) Info {
+	info := Info{
+		Title:       first(xmpList(xmp, "dc:title")),
+		Description: first(xmpList(xmp, "dc:description")),
+		People:      xmpList(xmp, "Iptc4xmpExt:PersonInImage"),
+	}
+	for _, name := range []string{"photoshop:DateCreated", "exif:DateTimeOriginal", "xmp:CreateDate"} {
+		if t, ok := parseXMPDate(xmpValue(xmp, name)); ok {
+			info.Taken = t
+			break
+		}
+	}
+	var place []string
+	for _, name := range []string{"photoshop:City", "photoshop:Country"} {
+		if v := xmpValue(xmp, name); v != "" {
+			place = append(place, v)
+		}
+	}
+	info.Place = strings.Join(place, ", ")
+	if len(info.People) == 0 { // Face regions from Lightroom, digiKam etc
+		for _, m := range regexp.MustCompile(`mwg-rs:Name="([^"]*)"`).FindAllStringSubmatch(xmp, -1) {
+			info.People = append(info.People, html.UnescapeString(m[1]))
+		}
+	}
+	return info
+}
+
+// A simple property as either name="value" or <name>value</name>
+func xmpValue(xmp, name string) string {
+	q := regexp.QuoteMeta(name)
+	re := regexp.MustCompile(q + `="([^"]*)"|<` + q + `>([^<]*)</` + q + `>`)
+	m := re.FindStringSubmatch(xmp)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(m[1] + m[2]))
+}
+
+// The items of an rdf:Alt, rdf:Bag or rdf:Seq property
+func xmpList(xmp, name string) []string {
+	q := regexp.QuoteMeta(name)
+	m := regexp.MustCompile(`(?s)<` + q + `>(.*?)</` + q + `>`).FindStringSubmatch(xmp)
+	if m == nil {
+		return nil
+	}
+	var items []string
+	for _, li := range regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`).FindAllStringSubmatch(m[1], -1) {
+		if v := strings.TrimSpace(html.UnescapeString(li[1])); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+func parseXMPDate(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func first(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
@@ -0,0 +1,50 @@
+/*
+Package meta describes a photo for captions: what it is, when and where it
+was taken and who is in it.
+
+The details come from PhotoPrism when the photo is from there, otherwise from
+the EXIF and XMP embedded in the JPEG.
+*/
+package meta
+
+import (
+	"time"
+)
+
+type Info struct {
+	Title       string
+	Description string
+	Taken       time.Time // Zero if not known
+	Place       string
+	People      []string
+	Orientation int // EXIF orientation, 0 if not known
+}
+
+// IsZero is true if nothing is known about the photo
+func (i Info) IsZero() bool {
+	return i.Title == "" && i.Description == "" && i.Taken.IsZero() &&
+		i.Place == "" && len(i.People) == 0 && i.Orientation == 0
+}
+
+// Merge fills in anything not known in i from other
+func (i Info) Merge(other Info) Info {
+	if i.Title == "" {
+		i.Title = other.Title
+	}
+	if i.Description == "" {
+		i.Description = other.Description
+	}
+	if i.Taken.IsZero() {
+		i.Taken = other.Taken
+	}
+	if i.Place == "" {
+		i.Place = other.Place
+	}
+	if len(i.People) == 0 {
+		i.People = other.People
+	}
+	if i.Orientation == 0 {
+		i.Orientation = other.Orientation
+	}
+	return i
+}
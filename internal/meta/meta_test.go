@@ -0,0 +1,71 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// Builds a minimal little endian EXIF block with a description, orientation
+// and date taken.
+func testExif() []byte {
+	le := binary.LittleEndian
+	desc := "Beach\x00"
+	date := "2014:06:03 10:20:30\x00"
+	var b bytes.Buffer
+	b.WriteString("II")
+	binary.Write(&b, le, uint16(42))
+	binary.Write(&b, le, uint32(8))
+	// IFD0 at 8 with 3 entries, data after it at 8+2+3*12+4 = 50
+	entry := func(tag, typ uint16, count, value uint32) {
+		binary.Write(&b, le, tag)
+		binary.Write(&b, le, typ)
+		binary.Write(&b, le, count)
+		binary.Write(&b, le, value)
+	}
+	binary.Write(&b, le, uint16(3))
+	entry(tagImageDescription, 2, uint32(len(desc)), 50)
+	entry(tagOrientation, 3, 1, 6)
+	entry(tagExifIFD, 4, 1, uint32(50+len(desc)))
+	binary.Write(&b, le, uint32(0))
+	b.WriteString(desc)
+	// Exif IFD with 1 entry
+	binary.Write(&b, le, uint16(1))
+	entry(tagDateTimeOriginal, 2, uint32(len(date)), uint32(b.Len()+12+4))
+	binary.Write(&b, le, uint32(0))
+	b.WriteString(date)
+	return append(append([]byte{}, exifHeader...), b.Bytes()...)
+}
+
+func segment(marker byte, data []byte) []byte {
+	return append([]byte{0xff, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}, data...)
+}
+
+func TestReadJPEG(t *testing.T) {
+	xmp := `<x:xmpmeta><rdf:RDF><rdf:Description photoshop:City="Brighton">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Fish &amp; chips</rdf:li></rdf:Alt></dc:title>
+<Iptc4xmpExt:PersonInImage><rdf:Bag><rdf:li>Ann</rdf:li><rdf:li>Bob</rdf:li></rdf:Bag></Iptc4xmpExt:PersonInImage>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+	jpeg := []byte{0xff, markerSOI}
+	jpeg = append(jpeg, segment(markerAPP1, testExif())...)
+	jpeg = append(jpeg, segment(markerAPP1, append(append([]byte{}, xmpHeader...), xmp...))...)
+	jpeg = append(jpeg, 0xff, markerSOS, 0, 2)
+
+	info, err := ReadJPEG(jpeg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Fish & chips" || info.Description != "Beach" || info.Place != "Brighton" {
+		t.Errorf("Wrong text %+v", info)
+	}
+	if len(info.People) != 2 || info.People[1] != "Bob" {
+		t.Errorf("Wrong people %v", info.People)
+	}
+	if info.Orientation != 6 {
+		t.Errorf("Orientation %d, want 6", info.Orientation)
+	}
+	if want := time.Date(2014, 6, 3, 10, 20, 30, 0, time.Local); !info.Taken.Equal(want) {
+		t.Errorf("Taken %v, want %v", info.Taken, want)
+	}
+}
@@ -0,0 +1,175 @@
+// Package monitor tells whether a screen is plugged in and what it is, from
+// the DRM connectors in sysfs: /sys/class/drm/card0-HDMI-A-1/status and
+// edid.  It is re-read on hotplug uevents, so it works whether the frame is
+// drawn through DRM or the frame buffer.
+//
+// Many TVs keep the HDMI hotplug line up in standby, so only a TV that is
+// switched off at the wall or unplugged shows as disconnected.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/drm"
+)
+
+// DefaultRoot is where sysfs is
+const DefaultRoot = "/sys"
+
+// Status of the screen
+type Status struct {
+	Connected bool
+	Connector string // eg card0-HDMI-A-1
+	Name      string // From the EDID, eg the TV's model
+	Width     int    // Native resolution from the EDID, 0 if not known
+	Height    int
+}
+
+func (s Status) String() string {
+	if !s.Connected {
+		return "nothing connected"
+	}
+	str := s.Connector
+	if s.Name != "" {
+		str += " " + s.Name
+	}
+	if s.Width > 0 {
+		str += fmt.Sprintf(" %dx%d", s.Width, s.Height)
+	}
+	return str
+}
+
+// Read finds the screen among the connectors under root, the first one
+// connected or the named connector, eg HDMI-A-1, if there is one.  There are
+// no connectors if the hardware has no DRM driver.
+func Read(root, connector string) (Status, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "class/drm/card*-*"))
+	if err != nil {
+		return Status{}, err
+	}
+	if len(dirs) == 0 {
+		return Status{}, errNoConnectors
+	}
+	var s Status
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		if connector != "" && !strings.HasSuffix(name, "-"+connector) {
+			continue
+		}
+		status, err := os.ReadFile(filepath.Join(dir, "status"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(status)) != "connected" {
+			continue
+		}
+		s = Status{Connected: true, Connector: name}
+		if edid, err := os.ReadFile(filepath.Join(dir, "edid")); err == nil && len(edid) > 0 {
+			if e, err := ParseEDID(edid); err != nil {
+				log.Printf("%s: %v", name, err)
+			} else {
+				s.Name, s.Width, s.Height = e.Name, e.Width, e.Height
+			}
+		}
+		break
+	}
+	return s, nil
+}
+
+var errNoConnectors = errors.New("no DRM connectors")
+
+// EDID is what is used from a display's EDID
+type EDID struct {
+	Manufacturer string // Three letter PNP ID
+	Name         string // Monitor name descriptor, may be empty
+	Width        int    // Preferred timing, the native resolution
+	Height       int
+}
+
+// ParseEDID reads the base block of an EDID
+func ParseEDID(b []byte) (EDID, error) {
+	var e EDID
+	if len(b) < 128 || !bytes.Equal(b[:8], []byte{0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0}) {
+		return e, errors.New("not an EDID")
+	}
+	var sum byte
+	for _, c := range b[:128] {
+		sum += c
+	}
+	if sum != 0 {
+		return e, errors.New("EDID checksum is wrong")
+	}
+	id := uint16(b[8])<<8 | uint16(b[9])
+	e.Manufacturer = string([]byte{byte(id>>10&31) + '@', byte(id>>5&31) + '@', byte(id&31) + '@'})
+	// Four 18 byte descriptors, the first is the preferred timing
+	for i := 54; i < 126; i += 18 {
+		d := b[i : i+18]
+		if d[0] != 0 || d[1] != 0 {
+			if i == 54 {
+				e.Width = int(d[2]) | int(d[4]&0xf0)<<4
+				e.Height = int(d[5]) | int(d[7]&0xf0)<<4
+			}
+			continue
+		}
+		if d[3] == 0xfc { // Monitor name, ended by a newline
+			name, _, _ := bytes.Cut(d[5:], []byte{'\n'})
+			e.Name = strings.TrimSpace(string(name))
+		}
+	}
+	return e, nil
+}
+
+// How often to look again without a hotplug event, as not every driver
+// sends them
+const pollEvery = 30 * time.Second
+
+// Watch sends the screen's status when it changes, starting with how it is
+// now.  Nothing is sent if there are no DRM connectors to watch.
+func Watch(ctx context.Context, root, connector string) <-chan Status {
+	changes := make(chan Status, 1)
+	s, err := Read(root, connector)
+	if err != nil {
+		log.Printf("Not watching the screen: %v", err)
+		return changes
+	}
+	changes <- s
+	hotplug, err := drm.Hotplug(ctx)
+	if err != nil {
+		log.Printf("No screen hotplug events, looking every %v: %v", pollEvery, err)
+	}
+	go func() {
+		ticker := time.NewTicker(pollEvery)
+		defer ticker.Stop()
+		last := s
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-hotplug:
+				if !ok {
+					hotplug = nil
+				}
+			case <-ticker.C:
+			}
+			s, err := Read(root, connector)
+			if err != nil || s == last {
+				continue
+			}
+			select {
+			case <-changes: // Only the latest matters
+			default:
+			}
+			changes <- s
+			last = s
+		}
+	}()
+	return changes
+}
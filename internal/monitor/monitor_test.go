@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An EDID for a 1920x1080 screen called Frame TV made by GPH
+func testEDID() []byte {
+	b := make([]byte, 128)
+	copy(b, []byte{0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0})
+	id := uint16('G'-'@')<<10 | uint16('P'-'@')<<5 | uint16('H'-'@')
+	b[8], b[9] = byte(id>>8), byte(id)
+	timing := b[54:72]
+	timing[0], timing[1] = 0x02, 0x3a // 148.5MHz
+	timing[2], timing[4] = 0x80, 0x70 // 1920
+	timing[5], timing[7] = 0x38, 0x40 // 1080
+	name := b[72:90]
+	name[3] = 0xfc
+	copy(name[5:], "Frame TV\n   ")
+	var sum byte
+	for _, c := range b[:127] {
+		sum += c
+	}
+	b[127] = -sum
+	return b
+}
+
+// Makes a sysfs tree with connectors, each status and edid
+func fakeSysfs(t *testing.T, connectors map[string][2]string) string {
+	root := t.TempDir()
+	for name, c := range connectors {
+		dir := filepath.Join(root, "class/drm", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, "status"), []byte(c[0]+"\n"), 0644)
+		os.WriteFile(filepath.Join(dir, "edid"), []byte(c[1]), 0644)
+	}
+	os.MkdirAll(filepath.Join(root, "class/drm/card0"), 0755) // The card itself isn't a connector
+	return root
+}
+
+func TestParseEDID(t *testing.T) {
+	e, err := ParseEDID(testEDID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (EDID{Manufacturer: "GPH", Name: "Frame TV", Width: 1920, Height: 1080}); e != want {
+		t.Errorf("EDID %+v, want %+v", e, want)
+	}
+	bad := testEDID()
+	bad[60]++
+	if _, err := ParseEDID(bad); err == nil {
+		t.Error("bad checksum accepted")
+	}
+}
+
+func TestRead(t *testing.T) {
+	edid := string(testEDID())
+	root := fakeSysfs(t, map[string][2]string{
+		"card0-HDMI-A-1": {"disconnected", ""},
+		"card0-HDMI-A-2": {"connected", edid},
+	})
+	s, err := Read(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Status{Connected: true, Connector: "card0-HDMI-A-2", Name: "Frame TV", Width: 1920, Height: 1080}); s != want {
+		t.Errorf("status %+v, want %+v", s, want)
+	}
+	if s, _ := Read(root, "HDMI-A-1"); s.Connected {
+		t.Errorf("HDMI-A-1 is %v", s)
+	}
+
+	// Unplugged
+	os.WriteFile(filepath.Join(root, "class/drm/card0-HDMI-A-2/status"), []byte("disconnected\n"), 0644)
+	if s, _ := Read(root, ""); s.Connected {
+		t.Errorf("unplugged is %v", s)
+	}
+
+	if _, err := Read(t.TempDir(), ""); err == nil {
+		t.Error("no connectors isn't an error")
+	}
+}
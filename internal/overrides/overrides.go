@@ -0,0 +1,100 @@
+// Package overrides remembers what people think of photos on the frame:
+// favourites, ratings and those never to be shown again.  They are kept in
+// the gokrazy permanent partition whatever the photo's source, so a hidden
+// photo stays hidden even if its source can't be told.
+package overrides
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Where overrides are kept unless OVERRIDES_FILE says otherwise
+const DefaultFile = "/perm/gophoto/overrides.json"
+
+// Override is what has been said about one photo
+type Override struct {
+	Favourite bool `json:"favourite,omitempty"`
+	Rating    int  `json:"rating,omitempty"` // 1 to 5, 0 if not rated
+	Hidden    bool `json:"hidden,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	overrides = make(map[string]Override) // By photo UID
+	file      string
+)
+
+// Load reads the saved overrides
+func Load() {
+	mu.Lock()
+	defer mu.Unlock()
+	file = os.Getenv("OVERRIDES_FILE")
+	if file == "" {
+		file = DefaultFile
+	}
+	overrides = make(map[string]Override)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Reading overrides: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		log.Printf("Overrides %s: %v", file, err)
+	}
+}
+
+// Get gives what has been said about a photo
+func Get(uid string) Override {
+	mu.Lock()
+	defer mu.Unlock()
+	return overrides[uid]
+}
+
+// Hidden is true if the photo should never be shown
+func Hidden(uid string) bool {
+	return Get(uid).Hidden
+}
+
+// Update changes what is kept for a photo and saves it
+func Update(uid string, change func(*Override)) (Override, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	o := overrides[uid]
+	change(&o)
+	if o == (Override{}) {
+		delete(overrides, uid)
+	} else {
+		overrides[uid] = o
+	}
+	return o, save()
+}
+
+// Writes to a temporary file and renames it, like the settings
+func save() error {
+	name := file
+	if name == "" {
+		name = DefaultFile
+	}
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("saving overrides: %v", err)
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("saving overrides: %v", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("saving overrides: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package overrides
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOverridesSaved(t *testing.T) {
+	t.Setenv("OVERRIDES_FILE", filepath.Join(t.TempDir(), "gophoto", "overrides.json"))
+	Load()
+	if Hidden("pt1") {
+		t.Fatal("hidden before anything was said")
+	}
+	if _, err := Update("pt1", func(o *Override) { o.Hidden = true }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Update("pt2", func(o *Override) { o.Favourite, o.Rating = true, 4 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Update("pt3", func(o *Override) { o.Rating = 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Update("pt3", func(o *Override) { o.Rating = 0 }); err != nil {
+		t.Fatal(err)
+	}
+
+	Load() // As after a restart
+	if !Hidden("pt1") {
+		t.Error("pt1 wasn't kept hidden")
+	}
+	if got, want := Get("pt2"), (Override{Favourite: true, Rating: 4}); got != want {
+		t.Errorf("pt2 is %+v, want %+v", got, want)
+	}
+	if len(overrides) != 2 {
+		t.Errorf("%d overrides kept, pt3 no longer has any", len(overrides))
+	}
+}
@@ -0,0 +1,292 @@
+package panel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/meta"
+	"github.com/fogleman/gg"
+)
+
+// Default caption, blank lines are left out
+const defaultCaption = `{{.Title}}
+{{.Description}}
+{{.When}}{{with .Place}} · {{.}}{{end}}
+{{.People}}`
+
+const (
+	defaultCaptionSize = 0.035 // Text height as fraction of panel height
+	fadeStep           = 50 * time.Millisecond
+)
+
+// CaptionPanel shows details of the current photo in a band across the top or
+// bottom of its area.  It can fade in when the photo changes and hide again
+// after a while.
+//
+// Options:
+//   - template: text/template for the caption using the fields of
+//     CaptionData, default shows title, description, date, place and people
+//   - position: top or bottom (default)
+//   - fade: seconds to fade in and out, default 1, 0 to not fade
+//   - hide: seconds to show the caption for, default 0 to always show it
+//   - locale: language for the month, as for the clock
+//   - colour: of the text, default white
+//   - band: colour of the band behind the text, default translucent black
+//   - size: height of the text as a fraction of the panel height
+type CaptionPanel struct {
+	Location image.Rectangle
+	tmpl     *template.Template
+	top      bool
+	fade     time.Duration
+	hide     time.Duration
+	locale   string
+	colour   color.RGBA
+	band     color.RGBA
+	size     float64
+
+	mu     sync.Mutex // Protects the rest as the photo is set from outside the runner
+	info   meta.Info
+	shown  time.Time // When info was set
+	dirty  bool
+	img    *image.RGBA // Rendered caption, nil if nothing to show
+	alpha  uint8
+	damage []image.Rectangle
+	now    func() time.Time
+}
+
+// CaptionData is what a caption template can use
+type CaptionData struct {
+	meta.Info
+	Date   string // Month and year taken, eg June 2014
+	Ago    string // How long ago it was taken, eg 10 years ago
+	When   string // Date and Ago together
+	People string // Names of the people in the photo
+}
+
+func init() {
+	Register("caption", func() Widget { return NewCaptionPanel() })
+}
+
+func NewCaptionPanel() *CaptionPanel {
+	p := new(CaptionPanel)
+	p.tmpl = template.Must(template.New("caption").Parse(defaultCaption))
+	p.fade = time.Second
+	p.locale = "en"
+	p.colour = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	p.band = color.RGBA{0, 0, 0, 0x80}
+	p.size = defaultCaptionSize
+	p.now = time.Now
+	return p
+}
+
+func (p *CaptionPanel) Init(ctx context.Context, cfg Config) error {
+	p.Location = cfg.Location
+	if text := cfg.String("template", ""); text != "" {
+		tmpl, err := template.New("caption").Parse(text)
+		if err != nil {
+			return fmt.Errorf("caption template: %v", err)
+		}
+		p.tmpl = tmpl
+	}
+	p.top = cfg.String("position", "bottom") == "top"
+	p.fade = seconds(cfg.Float("fade", p.fade.Seconds()))
+	p.hide = seconds(cfg.Float("hide", p.hide.Seconds()))
+	p.locale = cfg.String("locale", p.locale)
+	p.colour = cfg.Colour("colour", p.colour)
+	p.band = cfg.Colour("band", p.band)
+	p.size = cfg.Float("size", p.size)
+	return nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// SetInfo changes the photo the caption is about and starts showing it again.
+// The widget should then be woken to update it.
+func (p *CaptionPanel) SetInfo(info meta.Info) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.info = info
+	p.shown = p.now()
+	p.dirty = true
+}
+
+func (p *CaptionPanel) Update(ctx context.Context, now time.Time) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	changed := p.dirty
+	p.damage = p.damage[:0]
+	if p.img != nil {
+		p.damage = append(p.damage, p.bandRect())
+	}
+	if p.dirty {
+		p.dirty = false
+		err = p.draw(now)
+		if p.img != nil {
+			p.damage = append(p.damage, p.bandRect())
+		}
+	}
+	if alpha := p.opacity(now); alpha != p.alpha {
+		p.alpha = alpha
+		changed = true
+	}
+	return changed, err
+}
+
+// Only the band of text changes
+func (p *CaptionPanel) Damage() []image.Rectangle {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.damage
+}
+
+// How visible the caption is at the moment, fading in and then out
+func (p *CaptionPanel) opacity(now time.Time) uint8 {
+	t := now.Sub(p.shown)
+	switch {
+	case p.img == nil:
+		return 0
+	case p.fade > 0 && t < p.fade:
+		return uint8(0xff * t / p.fade)
+	case p.hide <= 0 || t < p.hide:
+		return 0xff
+	case p.fade > 0 && t < p.hide+p.fade:
+		return uint8(0xff - 0xff*(t-p.hide)/p.fade)
+	}
+	return 0
+}
+
+// Update often while fading, otherwise wait until it is time to hide or a
+// new photo is shown
+func (p *CaptionPanel) Interval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.img == nil {
+		return 0
+	}
+	t := p.now().Sub(p.shown)
+	switch {
+	case t < p.fade:
+		return fadeStep
+	case p.hide <= 0:
+		return 0
+	case t < p.hide:
+		return p.hide - t
+	case t < p.hide+p.fade:
+		return fadeStep
+	}
+	return 0
+}
+
+// Expands the template and draws the band of text
+func (p *CaptionPanel) draw(now time.Time) error {
+	p.img = nil
+	var out bytes.Buffer
+	if err := p.tmpl.Execute(&out, p.data(now)); err != nil {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	size := p.size * float64(p.Location.Dy())
+	face, err := NewFace(false, size)
+	if err != nil {
+		return err
+	}
+	lineHeight := size * 1.4
+	margin := size
+	w := p.Location.Dx()
+	h := int(math.Ceil(float64(len(lines))*lineHeight + margin))
+	g := gg.NewContext(w, h)
+	g.SetColor(p.band)
+	g.Clear()
+	g.SetFontFace(face)
+	g.SetColor(p.colour)
+	for i, line := range lines {
+		g.DrawString(line, margin, margin/2+size+float64(i)*lineHeight)
+	}
+	p.img = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(p.img, p.img.Bounds(), g.Image(), image.Point{}, draw.Src)
+	return nil
+}
+
+func (p *CaptionPanel) data(now time.Time) CaptionData {
+	d := CaptionData{Info: p.info, People: strings.Join(p.info.People, ", ")}
+	if taken := p.info.Taken; !taken.IsZero() {
+		d.Date = fmt.Sprintf("%s %d", monthName(taken.Month(), p.locale), taken.Year())
+		d.Ago = Ago(taken, now)
+		d.When = d.Date + " · " + d.Ago
+	}
+	return d
+}
+
+// Ago describes how long before now t was, eg "10 years ago"
+func Ago(t, now time.Time) string {
+	years := now.Year() - t.Year()
+	months := int(now.Month()) - int(t.Month())
+	if now.Day() < t.Day() {
+		months--
+	}
+	if months < 0 {
+		years--
+		months += 12
+	}
+	days := int(now.Sub(t).Hours() / 24)
+	switch {
+	case years > 0:
+		return plural(years, "year") + " ago"
+	case months > 0:
+		return plural(months, "month") + " ago"
+	case days > 1:
+		return plural(days, "day") + " ago"
+	case days == 1:
+		return "yesterday"
+	}
+	return "today"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "a " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+func (p *CaptionPanel) Render(buffer *image.RGBA) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.img == nil || p.alpha == 0 {
+		return
+	}
+	mask := image.NewUniform(color.Alpha{p.alpha})
+	draw.DrawMask(buffer, p.bandRect(), p.img, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// Where the caption is drawn
+func (p *CaptionPanel) bandRect() image.Rectangle {
+	r := p.img.Bounds()
+	if p.top {
+		return r.Add(p.Location.Min)
+	}
+	return r.Add(image.Pt(p.Location.Min.X, p.Location.Max.Y-r.Dy()))
+}
+
+func (p *CaptionPanel) Close() error { return nil }
@@ -0,0 +1,272 @@
+package panel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fogleman/gg"
+
+	_ "time/tzdata" // gokrazy has no zoneinfo
+)
+
+// Defaults for the clock, sizes are fractions of the panel height
+const (
+	defaultClockSize = 0.08
+	clockDateScale   = 0.4  // Date text relative to the time
+	clockMargin      = 0.03 // Gap between the clock and the edge of the panel
+)
+
+// ClockPanel shows the time and date in one corner of its area, usually laid
+// over the photo.  The text is only redrawn when the minute changes.
+//
+// Options:
+//   - format: 24h (default) or 12h
+//   - timezone: eg Europe/London, default local time
+//   - locale: language for the date, en (default), de, es, fr, it or nl
+//   - date: show the date under the time, default true
+//   - corner: tl, tr, bl or br (default)
+//   - style: outline (default), shadow or none, to stand out over any photo
+//   - colour: of the text, default white
+//   - size: height of the time as a fraction of the panel height
+type ClockPanel struct {
+	Location image.Rectangle // Area the clock is placed in
+	hour12   bool
+	zone     *time.Location
+	locale   string
+	showDate bool
+	corner   string
+	style    string
+	colour   color.RGBA
+	size     float64
+
+	timeText, dateText string
+	img                *image.RGBA // Rendered text
+	damage             []image.Rectangle
+	now                func() time.Time
+}
+
+func init() {
+	Register("clock", func() Widget { return NewClockPanel() })
+}
+
+func NewClockPanel() *ClockPanel {
+	p := new(ClockPanel)
+	p.zone = time.Local
+	p.locale = "en"
+	p.showDate = true
+	p.corner = "br"
+	p.style = "outline"
+	p.colour = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	p.size = defaultClockSize
+	p.now = time.Now
+	return p
+}
+
+func (p *ClockPanel) Init(ctx context.Context, cfg Config) error {
+	p.Location = cfg.Location
+	p.hour12 = cfg.String("format", "24h") == "12h"
+	if tz := cfg.String("timezone", ""); tz != "" {
+		zone, err := time.LoadLocation(tz)
+		if err != nil {
+			return fmt.Errorf("clock timezone: %v", err)
+		}
+		p.zone = zone
+	}
+	p.locale = cfg.String("locale", p.locale)
+	if _, ok := dateFormats[p.locale]; !ok {
+		return fmt.Errorf("clock locale %q not supported", p.locale)
+	}
+	p.showDate = cfg.Bool("date", p.showDate)
+	p.corner = cfg.String("corner", p.corner)
+	p.style = cfg.String("style", p.style)
+	p.colour = cfg.Colour("colour", p.colour)
+	p.size = cfg.Float("size", p.size)
+	return nil
+}
+
+// Wake just after the minute changes
+func (p *ClockPanel) Interval() time.Duration {
+	now := p.now()
+	return now.Truncate(time.Minute).Add(time.Minute + 50*time.Millisecond).Sub(now)
+}
+
+func (p *ClockPanel) Update(ctx context.Context, now time.Time) (bool, error) {
+	now = now.In(p.zone)
+	timeText := now.Format("15:04")
+	if p.hour12 {
+		timeText = now.Format("3:04 PM")
+	}
+	dateText := ""
+	if p.showDate {
+		dateText = FormatDate(now, p.locale)
+	}
+	if timeText == p.timeText && dateText == p.dateText && p.img != nil {
+		return false, nil
+	}
+	p.timeText, p.dateText = timeText, dateText
+	p.damage = p.damage[:0]
+	if p.img != nil {
+		p.damage = append(p.damage, p.textRect())
+	}
+	err := p.draw()
+	if p.img != nil {
+		p.damage = append(p.damage, p.textRect())
+	}
+	return true, err
+}
+
+// Only the old and new text need redrawing
+func (p *ClockPanel) Damage() []image.Rectangle {
+	return p.damage
+}
+
+// Draws the text into a small image that is copied over the photo on render
+func (p *ClockPanel) draw() error {
+	timeSize := p.size * float64(p.Location.Dy())
+	timeFace, err := NewFace(true, timeSize)
+	if err != nil {
+		return err
+	}
+	dateFace, err := NewFace(false, timeSize*clockDateScale)
+	if err != nil {
+		return err
+	}
+	outline := math.Max(1, timeSize/24)
+
+	// Measure
+	measure := gg.NewContext(1, 1)
+	measure.SetFontFace(timeFace)
+	tw, _ := measure.MeasureString(p.timeText)
+	measure.SetFontFace(dateFace)
+	dw, _ := measure.MeasureString(p.dateText)
+	w := int(math.Max(tw, dw) + 4*outline)
+	h := int(timeSize*1.1 + 4*outline)
+	if p.dateText != "" {
+		h += int(timeSize * clockDateScale * 1.3)
+	}
+
+	// Align the text to the side of the corner it is in
+	ax, x := 1.0, float64(w)-2*outline
+	if strings.HasSuffix(p.corner, "l") {
+		ax, x = 0, 2*outline
+	}
+	g := gg.NewContext(w, h)
+	g.SetFontFace(timeFace)
+	drawLegibleString(g, p.timeText, x, 2*outline+timeSize*0.85, ax, p.style, outline, p.colour)
+	if p.dateText != "" {
+		g.SetFontFace(dateFace)
+		y := 2*outline + timeSize*1.1 + timeSize*clockDateScale
+		drawLegibleString(g, p.dateText, x, y, ax, p.style, math.Max(1, outline/2), p.colour)
+	}
+	p.img = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(p.img, p.img.Bounds(), g.Image(), image.Point{}, draw.Src)
+	return nil
+}
+
+// Draws text with a dark outline or shadow so it can be read on any photo
+func drawLegibleString(g *gg.Context, s string, x, y, ax float64, style string, width float64, c color.RGBA) {
+	g.SetColor(color.RGBA{0, 0, 0, 0xc0})
+	switch style {
+	case "outline":
+		for dy := -width; dy <= width; dy += width {
+			for dx := -width; dx <= width; dx += width {
+				if dx != 0 || dy != 0 {
+					g.DrawStringAnchored(s, x+dx, y+dy, ax, 0)
+				}
+			}
+		}
+	case "shadow":
+		g.DrawStringAnchored(s, x+width, y+width, ax, 0)
+	}
+	g.SetColor(c)
+	g.DrawStringAnchored(s, x, y, ax, 0)
+}
+
+func (p *ClockPanel) Render(buffer *image.RGBA) {
+	if p.img == nil {
+		return
+	}
+	draw.Draw(buffer, p.textRect(), p.img, image.Point{}, draw.Over)
+}
+
+// Where the text goes within the panel
+func (p *ClockPanel) textRect() image.Rectangle {
+	size := p.img.Bounds().Size()
+	margin := int(clockMargin * float64(p.Location.Dy()))
+	x := p.Location.Max.X - margin - size.X
+	if strings.HasSuffix(p.corner, "l") {
+		x = p.Location.Min.X + margin
+	}
+	y := p.Location.Max.Y - margin - size.Y
+	if strings.HasPrefix(p.corner, "t") {
+		y = p.Location.Min.Y + margin
+	}
+	return image.Rectangle{image.Point{x, y}, image.Point{x, y}.Add(size)}
+}
+
+func (p *ClockPanel) Close() error { return nil }
+
+// Names and order of the date in a few languages
+type dateFormat struct {
+	days   [7]string // Starting on Sunday
+	months [12]string
+	format func(day, month string, date int) string
+}
+
+var dateFormats = map[string]dateFormat{
+	"en": {
+		[7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		[12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		func(day, month string, date int) string { return fmt.Sprintf("%s %d %s", day, date, month) },
+	},
+	"de": {
+		[7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		[12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		func(day, month string, date int) string { return fmt.Sprintf("%s, %d. %s", day, date, month) },
+	},
+	"es": {
+		[7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		[12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		func(day, month string, date int) string { return fmt.Sprintf("%s, %d de %s", day, date, month) },
+	},
+	"fr": {
+		[7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		[12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		func(day, month string, date int) string { return fmt.Sprintf("%s %d %s", day, date, month) },
+	},
+	"it": {
+		[7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		[12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		func(day, month string, date int) string { return fmt.Sprintf("%s %d %s", day, date, month) },
+	},
+	"nl": {
+		[7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		[12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		func(day, month string, date int) string { return fmt.Sprintf("%s %d %s", day, date, month) },
+	},
+}
+
+// FormatDate gives the date like "Monday 3 June" in the language of locale,
+// falling back to English.
+func FormatDate(t time.Time, locale string) string {
+	f, ok := dateFormats[locale]
+	if !ok {
+		f = dateFormats["en"]
+	}
+	return f.format(f.days[t.Weekday()], f.months[t.Month()-1], t.Day())
+}
+
+// Name of the month in the language of locale
+func monthName(m time.Month, locale string) string {
+	f, ok := dateFormats[locale]
+	if !ok {
+		f = dateFormats["en"]
+	}
+	return f.months[m-1]
+}
@@ -1,42 +1,64 @@
 package panel
 
 import (
+	"context"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
+	"os"
 
 	"github.com/fogleman/gg"
 	xdraw "golang.org/x/image/draw"
+
+	_ "image/jpeg"
+	_ "image/png"
 )
 
+// PlainPanel fills its area with a single colour, eg a bar behind a caption.
 type PlainPanel struct {
-	// config
-	img      draw.Image
-	Bounds   image.Rectangle
-	W, H     int
-	buffer   *image.RGBA
+	Static
 	bgcolor  color.RGBA
-	g        *gg.Context
 	Location image.Rectangle // Where panel is to be rendered
 }
 
 type ImagePanel struct {
+	Static
 	// config
 	img      image.Image
 	Bounds   image.Rectangle
 	W, H     int
 	buffer   *image.RGBA
+	scaled   *image.RGBA // img scaled to Location, made on first render
 	bgcolor  color.RGBA
 	g        *gg.Context
 	Location image.Rectangle // Where panel is to be rendered
 }
 
-func NewPlainPanel(w, h int) *PlainPanel {
+func init() {
+	Register("plain", func() Widget { return new(PlainPanel) })
+	Register("image", func() Widget { return new(ImagePanel) })
+	Register("photo", func() Widget { return new(PhotoPanel) })
+	Register("text", func() Widget { return NewTextPanel("", image.Rectangle{}) })
+}
+
+func NewPlainPanel(c color.RGBA) *PlainPanel {
 	p := new(PlainPanel)
-	p.g = gg.NewContext(w, h)
+	p.bgcolor = c
 	return p
 }
 
+func (p *PlainPanel) Init(ctx context.Context, cfg Config) error {
+	p.Location = cfg.Location
+	p.bgcolor = cfg.Colour("colour", p.bgcolor)
+	return nil
+}
+
+func (p *PlainPanel) Render(buffer *image.RGBA) {
+	draw.Draw(buffer, p.Location, &image.Uniform{p.bgcolor}, image.Point{}, draw.Over)
+}
+
 // This does the initial rendering of the image to
 // create the static image.  This is then copied
 // during the rendering process
@@ -48,6 +70,27 @@ func NewImagePanel(img image.Image) *ImagePanel {
 	return p
 }
 
+// Options are "src" the image file, unless the panel was created with an
+// image, and "fit" which is either fit (default) or fill.
+func (p *ImagePanel) Init(ctx context.Context, cfg Config) error {
+	if p.img == nil {
+		src := cfg.String("src", "")
+		f, err := os.Open(src)
+		if err != nil {
+			return fmt.Errorf("image panel: %v", err)
+		}
+		defer f.Close()
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return fmt.Errorf("image panel decoding %s: %v", src, err)
+		}
+		p.img = img
+		p.Resize(p.img.Bounds())
+	}
+	p.Location = FitRect(p.img.Bounds(), cfg.Location, cfg.String("fit", "fit") == "fill")
+	return nil
+}
+
 // // the location size should be the same as the initial image
 func (p *ImagePanel) Resize(bounds image.Rectangle) {
 	p.Bounds = bounds
@@ -58,7 +101,24 @@ func (p *ImagePanel) Resize(bounds image.Rectangle) {
 
 // // Draws on an image buffer the contents of the panel
 // // the location size should be the same as the initial image
+// The scaled image is kept so redrawing part of the screen is just a copy.
+// It is drawn over what is below so logos with transparency work.
 func (p *ImagePanel) Render(buffer *image.RGBA) {
-	draw.Draw(buffer, p.Location, p.g.Image(), image.Point{0, 0}, draw.Src)
-	xdraw.BiLinear.Scale(buffer, p.Location, p.img, p.img.Bounds(), draw.Over, nil)
+	if p.scaled == nil || p.scaled.Bounds() != p.Location {
+		p.scaled = image.NewRGBA(p.Location)
+		xdraw.BiLinear.Scale(p.scaled, p.Location, p.img, p.img.Bounds(), draw.Src, nil)
+	}
+	draw.Draw(buffer, p.Location, p.scaled, p.Location.Min, draw.Over)
+}
+
+// FitRect centres an image of size src in dst, either fitting inside it or
+// filling it completely.
+func FitRect(src image.Rectangle, dst image.Rectangle, fill bool) image.Rectangle {
+	ratio := math.Min(float64(dst.Dx())/float64(src.Dx()), float64(dst.Dy())/float64(src.Dy()))
+	if fill {
+		ratio = math.Max(float64(dst.Dx())/float64(src.Dx()), float64(dst.Dy())/float64(src.Dy()))
+	}
+	size := image.Point{int(ratio * float64(src.Dx())), int(ratio * float64(src.Dy()))}
+	min := dst.Min.Add(dst.Size().Sub(size).Div(2))
+	return image.Rectangle{min, min.Add(size)}
 }
@@ -0,0 +1,45 @@
+package panel
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"sync"
+)
+
+// PhotoPanel shows the current photo of the slide show.  The photo is scaled
+// to the size of the panel before it is handed over so rendering is just a
+// copy.
+type PhotoPanel struct {
+	Static
+	mu       sync.Mutex
+	img      image.Image
+	Location image.Rectangle // Where panel is to be rendered
+}
+
+func NewPhotoPanel(location image.Rectangle) *PhotoPanel {
+	p := new(PhotoPanel)
+	p.Location = location
+	return p
+}
+
+func (p *PhotoPanel) Init(ctx context.Context, cfg Config) error {
+	p.Location = cfg.Location
+	return nil
+}
+
+// Replace the photo, img should already be the size of the panel.
+func (p *PhotoPanel) SetImage(img image.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.img = img
+}
+
+func (p *PhotoPanel) Render(buffer *image.RGBA) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.img == nil {
+		return
+	}
+	draw.Draw(buffer, p.Location, p.img, p.img.Bounds().Min, draw.Over)
+}
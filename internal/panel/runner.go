@@ -0,0 +1,160 @@
+package panel
+
+import (
+	"context"
+	"errors"
+	"image"
+	"log"
+	"sync"
+	"time"
+)
+
+// Runner runs widgets, each on its own update schedule, and signals when any
+// of them need redrawing.
+type Runner struct {
+	mu      sync.Mutex
+	running []*running
+	damage  []image.Rectangle // Changed since last asked
+	changed chan struct{}
+}
+
+// A widget being run.  The lock stops Update and Render overlapping.
+type running struct {
+	mu     sync.Mutex
+	widget Widget
+	name   string
+	rect   image.Rectangle // Where it draws
+	cancel context.CancelFunc
+	done   chan struct{}
+	wake   chan struct{}
+}
+
+func NewRunner() *Runner {
+	return &Runner{changed: make(chan struct{}, 1)}
+}
+
+// Changed signals when a widget has updated and the frame should be redrawn
+func (r *Runner) Changed() <-chan struct{} {
+	return r.changed
+}
+
+// Start initialises and updates the widget, then keeps updating it in the
+// background until ctx is cancelled or the runner closed.  The returned
+// panel is what should be rendered.
+func (r *Runner) Start(ctx context.Context, w Widget, cfg Config) (*Running, error) {
+	if err := w.Init(ctx, cfg); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	rw := &running{widget: w, name: cfg.Name, rect: cfg.Location, cancel: cancel,
+		done: make(chan struct{}), wake: make(chan struct{}, 1)}
+	rw.update(ctx)
+	r.mu.Lock()
+	r.running = append(r.running, rw)
+	r.mu.Unlock()
+	go r.loop(ctx, rw)
+	return &Running{rw}, nil
+}
+
+func (r *Runner) loop(ctx context.Context, rw *running) {
+	defer close(rw.done)
+	for {
+		rw.mu.Lock()
+		interval := rw.widget.Interval()
+		rw.mu.Unlock()
+		timer := time.NewTimer(interval)
+		timeout := timer.C
+		if interval <= 0 {
+			timeout = nil // Only update when woken
+		}
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timeout:
+		case <-rw.wake:
+		}
+		timer.Stop()
+		if rw.update(ctx) {
+			r.mu.Lock()
+			r.damage = append(r.damage, rw.damage()...)
+			r.mu.Unlock()
+			select {
+			case r.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (rw *running) update(ctx context.Context) bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	changed, err := rw.widget.Update(ctx, time.Now())
+	if err != nil {
+		log.Printf("Widget %s update failed: %v", rw.name, err)
+	}
+	return changed
+}
+
+// The parts of the screen changed by the last update, everywhere the widget
+// can draw unless it says otherwise.
+func (rw *running) damage() []image.Rectangle {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if d, ok := rw.widget.(Damager); ok {
+		return d.Damage()
+	}
+	return []image.Rectangle{rw.rect}
+}
+
+// Damage returns the areas that have changed since it was last called
+func (r *Runner) Damage() []image.Rectangle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	damage := r.damage
+	r.damage = nil
+	return damage
+}
+
+// Close stops all the widgets and closes them
+func (r *Runner) Close() error {
+	r.mu.Lock()
+	running := r.running
+	r.running = nil
+	r.mu.Unlock()
+	var errs []error
+	for _, rw := range running {
+		rw.cancel()
+		<-rw.done
+		if err := rw.widget.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Running is a widget started by a Runner, safe to render while it updates.
+type Running struct {
+	rw *running
+}
+
+func (p *Running) Render(buffer *image.RGBA) {
+	p.rw.mu.Lock()
+	defer p.rw.mu.Unlock()
+	p.rw.widget.Render(buffer)
+}
+
+// Wake updates the widget now rather than waiting for its interval, eg
+// after it has been given something new to show.
+func (p *Running) Wake() {
+	select {
+	case p.rw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Widget returns the underlying widget
+func (p *Running) Widget() Widget {
+	return p.rw.widget
+}
@@ -0,0 +1,82 @@
+package panel
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// Fraction of the panel height used for the text when no size is given
+const defaultTextSize = 0.6
+
+// TextPanel shows a fixed line of text centred in the panel.
+type TextPanel struct {
+	Static
+	Text     string
+	Colour   color.Color
+	Bold     bool
+	Size     float64         // Height of the text as a fraction of the panel height
+	Location image.Rectangle // Where panel is to be rendered
+	g        *gg.Context
+}
+
+func NewTextPanel(text string, location image.Rectangle) *TextPanel {
+	p := new(TextPanel)
+	p.Text = text
+	p.Colour = color.White
+	p.Size = defaultTextSize
+	p.Location = location
+	return p
+}
+
+// Options are "text", "colour", "bold" and "size" as a fraction of the panel
+// height.
+func (p *TextPanel) Init(ctx context.Context, cfg Config) error {
+	p.Location = cfg.Location
+	p.Text = cfg.String("text", p.Text)
+	p.Colour = cfg.Colour("colour", color.RGBAModel.Convert(p.Colour).(color.RGBA))
+	p.Bold = cfg.Bool("bold", p.Bold)
+	p.Size = cfg.Float("size", p.Size)
+	p.g = nil
+	return nil
+}
+
+// Draws the text once, it is then copied on each render
+func (p *TextPanel) draw() {
+	w, h := p.Location.Dx(), p.Location.Dy()
+	p.g = gg.NewContext(w, h)
+	face, err := NewFace(p.Bold, p.Size*float64(h))
+	if err != nil {
+		return
+	}
+	p.g.SetFontFace(face)
+	p.g.SetColor(p.Colour)
+	p.g.DrawStringAnchored(p.Text, float64(w)/2, float64(h)/2, 0.5, 0.35)
+}
+
+func (p *TextPanel) Render(buffer *image.RGBA) {
+	if p.g == nil || p.g.Width() != p.Location.Dx() || p.g.Height() != p.Location.Dy() {
+		p.draw()
+	}
+	draw.Draw(buffer, p.Location, p.g.Image(), image.Point{0, 0}, draw.Over)
+}
+
+// NewFace returns one of the built in Go fonts at a size in pixels.
+func NewFace(bold bool, size float64) (font.Face, error) {
+	ttf := goregular.TTF
+	if bold {
+		ttf = gobold.TTF
+	}
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
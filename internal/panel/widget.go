@@ -0,0 +1,146 @@
+package panel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config is what a widget is told about itself when it is created, mostly
+// taken from the layout.
+type Config struct {
+	Name     string            // Name the widget was registered under, eg "clock"
+	Location image.Rectangle   // Where the widget is drawn on the frame
+	Options  map[string]string // Widget specific settings
+}
+
+// Widget is a panel with a life of its own.  It is created by name from the
+// registry, initialised once, then updated on its own schedule and rendered
+// whenever the frame is redrawn.  Update and Render are never called at the
+// same time.
+type Widget interface {
+	Init(ctx context.Context, cfg Config) error
+	// Update refreshes the content and reports whether it needs redrawing.
+	Update(ctx context.Context, now time.Time) (bool, error)
+	// Render draws the widget, buffer is clipped to the widget's area.
+	Render(buffer *image.RGBA)
+	// Interval is how long until the next Update, 0 means only when woken.  It is asked
+	// again after every update so a widget can change its pace.
+	Interval() time.Duration
+	Close() error
+}
+
+// Damager is a widget that knows which parts of its area changed in its last
+// update, so the rest needn't be redrawn or copied to the screen.
+type Damager interface {
+	Damage() []image.Rectangle
+}
+
+// Factory creates a new, uninitialised widget
+type Factory func() Widget
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a widget available by name to layouts.  It is normally called
+// from an init function and panics if the name is already taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("panel: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("panel: Register called twice for widget " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates an uninitialised widget registered under name
+func New(name string) (Widget, error) {
+	registryMu.Lock()
+	factory, ok := registry[name]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown widget %q", name)
+	}
+	return factory(), nil
+}
+
+// Registered returns the sorted names of all the widgets
+func Registered() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Option helpers for widgets reading their Config
+
+// String returns the option or def if it isn't set
+func (c Config) String(key, def string) string {
+	if v, ok := c.Options[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Float returns the option as a number or def if it isn't set or valid
+func (c Config) Float(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(c.Options[key], 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// Bool returns the option as a boolean or def if it isn't set or valid
+func (c Config) Bool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(c.Options[key]); err == nil {
+		return v
+	}
+	return def
+}
+
+// Colour returns the option as a colour or def if it isn't set or valid
+func (c Config) Colour(key string, def color.RGBA) color.RGBA {
+	if v, err := ParseColour(c.Options[key]); err == nil {
+		return v
+	}
+	return def
+}
+
+// ParseColour converts a colour in #rrggbb or #rrggbbaa form
+func ParseColour(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 0xff}
+	var err error
+	switch len(s) {
+	case 7:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = fmt.Errorf("wrong length")
+	}
+	if err != nil {
+		return c, fmt.Errorf("bad colour %q, want #rrggbb: %v", s, err)
+	}
+	return c, nil
+}
+
+// Static can be embedded in widgets that never change after Init
+type Static struct{}
+
+func (Static) Update(ctx context.Context, now time.Time) (bool, error) { return false, nil }
+func (Static) Interval() time.Duration                                 { return 0 }
+func (Static) Close() error                                            { return nil }
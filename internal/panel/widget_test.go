@@ -0,0 +1,81 @@
+package panel
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+)
+
+type tickWidget struct {
+	Static
+	ticks int
+}
+
+func (w *tickWidget) Init(ctx context.Context, cfg Config) error { return nil }
+func (w *tickWidget) Render(buffer *image.RGBA)                  {}
+func (w *tickWidget) Interval() time.Duration                    { return time.Millisecond }
+func (w *tickWidget) Update(ctx context.Context, now time.Time) (bool, error) {
+	w.ticks++
+	return true, nil
+}
+
+func TestRunnerUpdatesWidget(t *testing.T) {
+	Register("test-tick", func() Widget { return new(tickWidget) })
+	w, err := New("test-tick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner()
+	if _, err := r.Start(context.Background(), w, Config{Name: "test-tick"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r.Changed():
+	case <-time.After(time.Second):
+		t.Fatal("widget never signalled a change")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ticks := w.(*tickWidget).ticks; ticks < 2 {
+		t.Fatalf("ticks = %d, want at least the initial update and one scheduled update", ticks)
+	}
+}
+
+func TestClockDate(t *testing.T) {
+	day := time.Date(2024, time.June, 3, 9, 5, 0, 0, time.UTC)
+	for locale, want := range map[string]string{
+		"en": "Monday 3 June",
+		"de": "Montag, 3. Juni",
+		"fr": "lundi 3 juin",
+		"xx": "Monday 3 June",
+	} {
+		if got := FormatDate(day, locale); got != want {
+			t.Errorf("%s: got %q, want %q", locale, got, want)
+		}
+	}
+
+	clock := NewClockPanel()
+	clock.now = func() time.Time { return day.Add(30 * time.Second) }
+	if i := clock.Interval(); i < 30*time.Second || i > 31*time.Second {
+		t.Errorf("Interval %v should wake at the next minute", i)
+	}
+}
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2024, time.June, 3, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		taken time.Time
+		want  string
+	}{
+		{time.Date(2014, time.June, 1, 0, 0, 0, 0, time.UTC), "10 years ago"},
+		{time.Date(2014, time.June, 5, 0, 0, 0, 0, time.UTC), "9 years ago"},
+		{time.Date(2024, time.April, 3, 0, 0, 0, 0, time.UTC), "2 months ago"},
+		{time.Date(2024, time.June, 2, 9, 0, 0, 0, time.UTC), "yesterday"},
+	} {
+		if got := Ago(c.taken, now); got != c.want {
+			t.Errorf("Ago(%v) = %q, want %q", c.taken, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package presence notices who is home from their phones on the LAN, so the
+// frame can choose the audience itself.  Devices are pinged by IP address.
+// Phones that don't answer pings still answer the ARP requests pinging makes,
+// so those the kernel's neighbour table has recently confirmed count too.
+// Stale entries don't, as they stay long after a phone has gone.
+package presence
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Device is something carried by someone, usually a phone
+type Device struct {
+	Name string
+	Addr string // IP address, fixed by the router so it can be pinged
+}
+
+// Config says which devices to look for and which audience to choose
+type Config struct {
+	Devices   []Device
+	Home      string        // Audience when any device is home
+	Away      string        // Audience when none are
+	Every     time.Duration // How often to look
+	AwayAfter time.Duration // How long a device must be missing to count as gone
+}
+
+// Defaults for the environment
+const (
+	DefaultEvery     = 30 * time.Second
+	DefaultAwayAfter = 10 * time.Minute // Phones sleep and drop off the Wi-Fi
+)
+
+// FromEnv reads the configuration from PRESENCE_DEVICES, eg
+// "jo=10.0.0.21,sam=10.0.0.22", PRESENCE_HOME (default family),
+// PRESENCE_AWAY (default guests), PRESENCE_EVERY and PRESENCE_AWAY_AFTER.
+// There are no devices if presence isn't wanted.
+func FromEnv() (Config, error) {
+	cfg := Config{Home: "family", Away: "guests", Every: DefaultEvery, AwayAfter: DefaultAwayAfter}
+	for _, d := range strings.Split(os.Getenv("PRESENCE_DEVICES"), ",") {
+		if strings.TrimSpace(d) == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(d, "=")
+		if !ok {
+			addr = name // Named by its address
+		}
+		addr = strings.TrimSpace(addr)
+		if net.ParseIP(addr) == nil {
+			return cfg, fmt.Errorf("PRESENCE_DEVICES %q should be name=IP", d)
+		}
+		cfg.Devices = append(cfg.Devices, Device{Name: strings.TrimSpace(name), Addr: addr})
+	}
+	if s := os.Getenv("PRESENCE_HOME"); s != "" {
+		cfg.Home = s
+	}
+	if s, ok := os.LookupEnv("PRESENCE_AWAY"); ok {
+		cfg.Away = s // Empty for everyone
+	}
+	for _, d := range []struct {
+		env string
+		dst *time.Duration
+	}{{"PRESENCE_EVERY", &cfg.Every}, {"PRESENCE_AWAY_AFTER", &cfg.AwayAfter}} {
+		if s := os.Getenv(d.env); s != "" {
+			v, err := time.ParseDuration(s)
+			if err != nil || v <= 0 {
+				return cfg, fmt.Errorf("%s %q should be a duration like 30s", d.env, s)
+			}
+			*d.dst = v
+		}
+	}
+	return cfg, nil
+}
+
+// Tracker remembers when each device was last seen.  A device is home as
+// soon as it is seen but only gone once it has been missing for AwayAfter,
+// so the audience doesn't flap as phones sleep.
+type Tracker struct {
+	AwayAfter time.Duration
+	lastSeen  map[string]time.Time
+}
+
+// Update records the devices seen now and gives who is home, sorted
+func (t *Tracker) Update(now time.Time, seen []string) []string {
+	if t.lastSeen == nil {
+		t.lastSeen = make(map[string]time.Time)
+	}
+	for _, name := range seen {
+		t.lastSeen[name] = now
+	}
+	var home []string
+	for name, last := range t.lastSeen {
+		if now.Sub(last) < t.AwayAfter {
+			home = append(home, name)
+		}
+	}
+	slices.Sort(home)
+	return home
+}
+
+// Audience chooses the audience for who is home
+func (cfg Config) Audience(home []string) string {
+	if len(home) > 0 {
+		return cfg.Home
+	}
+	return cfg.Away
+}
+
+// Change is a new audience and who caused it
+type Change struct {
+	Audience string
+	Home     []string
+}
+
+// Watch looks for the devices every so often and sends the audience when it
+// changes, starting with the first look.  Without devices it sends nothing.
+func Watch(ctx context.Context, cfg Config) <-chan Change {
+	changes := make(chan Change, 1)
+	if len(cfg.Devices) == 0 {
+		return changes
+	}
+	go func() {
+		tracker := Tracker{AwayAfter: cfg.AwayAfter}
+		ticker := time.NewTicker(cfg.Every)
+		defer ticker.Stop()
+		last := "\x00" // Not an audience so the first is always sent
+		for {
+			home := tracker.Update(time.Now(), look(cfg.Devices))
+			if a := cfg.Audience(home); a != last {
+				select {
+				case changes <- Change{Audience: a, Home: home}:
+					last = a
+				default: // Not taken yet, try again next time
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return changes
+}
+
+// Names of the devices that can be seen.  Those not answering pings are
+// looked for in the neighbour table, where an ARP answer to this or the last
+// look's ping leaves them reachable.
+func look(devices []Device) []string {
+	var seen, silent []Device
+	for _, d := range devices {
+		if pingable(d.Addr) {
+			seen = append(seen, d)
+		} else {
+			silent = append(silent, d)
+		}
+	}
+	if len(silent) > 0 {
+		table, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+		if err == nil {
+			var ips []string
+			if ips, err = Reachable(table); err == nil {
+				for _, d := range silent {
+					if slices.Contains(ips, net.ParseIP(d.Addr).String()) {
+						seen = append(seen, d)
+					}
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Presence: neighbour table: %v", err)
+		}
+	}
+	var names []string
+	for _, d := range seen {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func pingable(addr string) bool {
+	pinger, err := ping.NewPinger(addr)
+	if err != nil {
+		return false
+	}
+	pinger.Count = 1
+	pinger.Timeout = time.Second
+	if err := pinger.Run(); err != nil {
+		log.Printf("Presence: pinging %s: %v", addr, err)
+		return false
+	}
+	return pinger.Statistics().PacketsRecv > 0
+}
+
+// From linux/neighbour.h
+const (
+	ndmsgLen     = 12   // family, padding, ifindex, state, flags and type
+	ndaDst       = 1    // Attribute with the IP address
+	nudReachable = 0x02 // Confirmed recently, stale entries are 0x04
+)
+
+// Reachable gives the IP addresses in a dump of the kernel's neighbour table
+// (RTM_GETNEIGH) that are reachable.  /proc/net/arp can't be used for this as
+// it marks stale entries complete too.
+func Reachable(table []byte) ([]string, error) {
+	msgs, err := syscall.ParseNetlinkMessage(table)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < ndmsgLen {
+			continue
+		}
+		if binary.NativeEndian.Uint16(m.Data[8:10])&nudReachable == 0 {
+			continue
+		}
+		for attrs := m.Data[ndmsgLen:]; len(attrs) >= syscall.SizeofRtAttr; {
+			n, kind := int(binary.NativeEndian.Uint16(attrs)), binary.NativeEndian.Uint16(attrs[2:])
+			if n < syscall.SizeofRtAttr || n > len(attrs) {
+				break
+			}
+			if kind == ndaDst {
+				ips = append(ips, net.IP(attrs[syscall.SizeofRtAttr:n]).String())
+			}
+			attrs = attrs[min((n+3)&^3, len(attrs)):] // Padded to 4 bytes
+		}
+	}
+	return ips, nil
+}
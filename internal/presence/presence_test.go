@@ -0,0 +1,86 @@
+package presence
+
+import (
+	"encoding/binary"
+	"net"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A neighbour table entry as the kernel dumps it
+func neighbour(ip string, state uint16) []byte {
+	addr := net.ParseIP(ip).To4()
+	m := make([]byte, syscall.NLMSG_HDRLEN+ndmsgLen+syscall.SizeofRtAttr+len(addr))
+	binary.NativeEndian.PutUint32(m, uint32(len(m)))
+	binary.NativeEndian.PutUint16(m[4:], syscall.RTM_NEWNEIGH)
+	nd := m[syscall.NLMSG_HDRLEN:]
+	nd[0] = syscall.AF_INET
+	binary.NativeEndian.PutUint16(nd[8:], state)
+	attr := nd[ndmsgLen:]
+	binary.NativeEndian.PutUint16(attr, uint16(len(attr)))
+	binary.NativeEndian.PutUint16(attr[2:], ndaDst)
+	copy(attr[syscall.SizeofRtAttr:], addr)
+	return m
+}
+
+func TestReachable(t *testing.T) {
+	var table []byte
+	table = append(table, neighbour("10.0.0.21", nudReachable)...)
+	table = append(table, neighbour("10.0.0.22", 0x04)...) // Stale, long gone
+	table = append(table, neighbour("10.0.0.23", 0x20)...) // Failed
+	got, err := Reachable(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.21"}; !slices.Equal(got, want) {
+		t.Errorf("reachable %v, want %v", got, want)
+	}
+}
+
+func TestHysteresis(t *testing.T) {
+	cfg := Config{Home: "family", Away: "guests"}
+	tracker := Tracker{AwayAfter: 10 * time.Minute}
+	start := time.Date(2024, 7, 1, 18, 0, 0, 0, time.UTC)
+	for _, step := range []struct {
+		after time.Duration
+		seen  []string
+		want  string
+	}{
+		{0, nil, "guests"},
+		{time.Minute, []string{"jo"}, "family"}, // Home straight away
+		{2 * time.Minute, nil, "family"},        // Phone asleep
+		{5 * time.Minute, []string{"sam"}, "family"},
+		{10 * time.Minute, nil, "family"}, // Sam still counts
+		{14 * time.Minute, nil, "family"},
+		{15 * time.Minute, nil, "guests"}, // Ten minutes since anyone
+	} {
+		home := tracker.Update(start.Add(step.after), step.seen)
+		if got := cfg.Audience(home); got != step.want {
+			t.Errorf("after %v with %v home: %s, want %s", step.after, home, got, step.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("PRESENCE_DEVICES", "jo=10.0.0.21, sam=10.0.0.22")
+	t.Setenv("PRESENCE_AWAY_AFTER", "20m")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Device{{"jo", "10.0.0.21"}, {"sam", "10.0.0.22"}}; !slices.Equal(cfg.Devices, want) {
+		t.Errorf("devices %v, want %v", cfg.Devices, want)
+	}
+	if cfg.AwayAfter != 20*time.Minute || cfg.Every != DefaultEvery || cfg.Home != "family" || cfg.Away != "guests" {
+		t.Errorf("config %+v", cfg)
+	}
+
+	for _, d := range []string{"jo=phone", "sam=aa:bb:cc:dd:ee:ff"} {
+		t.Setenv("PRESENCE_DEVICES", d)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("%s was accepted without an IP address", d)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package schedule says when the screen should be on, so it can be blanked
+// at night.  There are on times for weekdays and weekends, given as clock
+// times or relative to sunrise and sunset, which are worked out from the
+// frame's latitude and longitude without asking anyone.
+package schedule
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a time of day, either on the clock or relative to the sun
+type Point struct {
+	Clock  time.Duration // Since midnight, if not relative to the sun
+	Sun    string        // sunrise or sunset
+	Offset time.Duration // From the sun
+}
+
+// ParsePoint reads "07:30", "sunrise", "sunset+30m" or "sunrise-1h"
+func ParsePoint(s string) (Point, error) {
+	s = strings.TrimSpace(s)
+	for _, sun := range []string{"sunrise", "sunset"} {
+		rest, ok := strings.CutPrefix(s, sun)
+		if !ok {
+			continue
+		}
+		p := Point{Sun: sun}
+		if rest != "" {
+			var err error
+			if p.Offset, err = time.ParseDuration(rest); err != nil || (rest[0] != '+' && rest[0] != '-') {
+				return p, fmt.Errorf("%q should be like %s+30m", s, sun)
+			}
+		}
+		return p, nil
+	}
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return Point{}, fmt.Errorf("%q should be a time like 07:30, sunrise or sunset", s)
+	}
+	return Point{Clock: time.Duration(h)*time.Hour + time.Duration(m)*time.Minute}, nil
+}
+
+func (p Point) String() string {
+	if p.Sun == "" {
+		return fmt.Sprintf("%02d:%02d", int(p.Clock.Hours()), int(p.Clock.Minutes())%60)
+	}
+	if p.Offset == 0 {
+		return p.Sun
+	}
+	sign := "+"
+	if p.Offset < 0 {
+		sign = ""
+	}
+	return p.Sun + sign + p.Offset.String()
+}
+
+// Window is when the screen is on, it may go past midnight
+type Window struct {
+	From, To Point
+}
+
+// Schedule has the on windows for the days of the week
+type Schedule struct {
+	Weekday, Weekend []Window
+	Latitude         float64
+	Longitude        float64
+	HasPlace         bool          // Latitude and longitude are given, needed for the sun
+	WakeFor          time.Duration // How long the screen stays on when woken at night
+}
+
+// How long to wake for if WAKE_FOR isn't set
+const DefaultWakeFor = time.Hour
+
+// ParseWindows reads windows like "07:00-23:30" or "sunrise-sunset+2h",
+// separated by commas
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, w := range strings.Split(s, ",") {
+		if strings.TrimSpace(w) == "" {
+			continue
+		}
+		from, to, ok := cutWindow(w)
+		if !ok {
+			return nil, fmt.Errorf("%q should be like 07:00-23:30", w)
+		}
+		f, err := ParsePoint(from)
+		if err != nil {
+			return nil, err
+		}
+		t, err := ParsePoint(to)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, Window{f, t})
+	}
+	return windows, nil
+}
+
+// Split a window at the dash with a point either side, as offsets such as
+// sunrise-1h have dashes too
+func cutWindow(w string) (from, to string, ok bool) {
+	for i, c := range w {
+		if c != '-' {
+			continue
+		}
+		_, fromErr := ParsePoint(w[:i])
+		_, toErr := ParsePoint(w[i+1:])
+		if fromErr == nil && toErr == nil {
+			return w[:i], w[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// FromEnv reads SCHEDULE_WEEKDAY, SCHEDULE_WEEKEND (the weekday windows if
+// not set), LATITUDE, LONGITUDE and WAKE_FOR.  It is nil if none are set.
+// With only a place the screen is always on but there is sunset for night
+// mode.
+func FromEnv() (*Schedule, error) {
+	weekday, weekend := os.Getenv("SCHEDULE_WEEKDAY"), os.Getenv("SCHEDULE_WEEKEND")
+	if weekday == "" && weekend == "" && os.Getenv("LATITUDE") == "" && os.Getenv("LONGITUDE") == "" {
+		return nil, nil
+	}
+	s := &Schedule{WakeFor: DefaultWakeFor}
+	var err error
+	if w := os.Getenv("WAKE_FOR"); w != "" {
+		if s.WakeFor, err = time.ParseDuration(w); err != nil || s.WakeFor <= 0 {
+			return nil, fmt.Errorf("WAKE_FOR %q should be a duration like 1h", w)
+		}
+	}
+	if s.Weekday, err = ParseWindows(weekday); err != nil {
+		return nil, fmt.Errorf("SCHEDULE_WEEKDAY: %v", err)
+	}
+	s.Weekend = s.Weekday
+	if weekend != "" {
+		if s.Weekend, err = ParseWindows(weekend); err != nil {
+			return nil, fmt.Errorf("SCHEDULE_WEEKEND: %v", err)
+		}
+	}
+	lat, long := os.Getenv("LATITUDE"), os.Getenv("LONGITUDE")
+	if lat != "" || long != "" {
+		if s.Latitude, err = strconv.ParseFloat(lat, 64); err != nil || math.Abs(s.Latitude) > 90 {
+			return nil, fmt.Errorf("LATITUDE %q should be degrees north, like 51.5", lat)
+		}
+		if s.Longitude, err = strconv.ParseFloat(long, 64); err != nil || math.Abs(s.Longitude) > 180 {
+			return nil, fmt.Errorf("LONGITUDE %q should be degrees east, like -0.12", long)
+		}
+		s.HasPlace = true
+	}
+	for _, w := range append(s.Weekday, s.Weekend...) {
+		if (w.From.Sun != "" || w.To.Sun != "") && !s.HasPlace {
+			return nil, fmt.Errorf("LATITUDE and LONGITUDE are needed for sunrise and sunset")
+		}
+	}
+	return s, nil
+}
+
+// At is when a point is on the day of t, in t's location
+func (s *Schedule) At(day time.Time, p Point) time.Time {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if p.Sun == "" {
+		// Counted on the clock so it is right on the days the clocks change
+		return midnight.Add(p.Clock)
+	}
+	rise, set := Sun(midnight, s.Latitude, s.Longitude)
+	if p.Sun == "sunrise" {
+		return rise.Add(p.Offset)
+	}
+	return set.Add(p.Offset)
+}
+
+// The windows for the day of t
+func (s *Schedule) windows(day time.Time) []Window {
+	if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return s.Weekend
+	}
+	return s.Weekday
+}
+
+// When a window on a day starts and ends.  Windows ending before they start
+// go on past midnight, those ending as they start are empty.
+func (s *Schedule) span(day time.Time, w Window) (from, to time.Time) {
+	from, to = s.At(day, w.From), s.At(day, w.To)
+	if to.Before(from) {
+		to = s.At(day.AddDate(0, 0, 1), w.To)
+	}
+	return from, to
+}
+
+// On says whether the screen should be on at t.  It always is if there are
+// no windows.
+func (s *Schedule) On(t time.Time) bool {
+	if s == nil || len(s.Weekday) == 0 && len(s.Weekend) == 0 {
+		return true
+	}
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} { // Yesterday's may run past midnight
+		for _, w := range s.windows(day) {
+			if from, to := s.span(day, w); !t.Before(from) && t.Before(to) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// How long night mode takes to come in or go
+const NightRamp = time.Hour
+
+// Night says how far into night mode t is, from 0 by day to 1 at night.
+// Given a place it comes in over the hour after sunset and goes over the
+// hour before sunrise.  Otherwise it comes in over the hour before the last
+// window of the day ends, ready for bed, and stays if the screen is woken.
+func (s *Schedule) Night(t time.Time) float64 {
+	ramp := func(d time.Duration) float64 {
+		return min(max(float64(d)/float64(NightRamp), 0), 1)
+	}
+	if s == nil {
+		return 0
+	}
+	if s.HasPlace {
+		rise, set := Sun(t, s.Latitude, s.Longitude)
+		switch {
+		case t.Before(rise):
+			return ramp(rise.Sub(t))
+		case t.After(set):
+			return ramp(t.Sub(set))
+		}
+		return 0
+	}
+	if !s.On(t) {
+		return 1
+	}
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		var bedtime time.Time
+		for _, w := range s.windows(day) {
+			if _, to := s.span(day, w); to.After(bedtime) {
+				bedtime = to
+			}
+		}
+		if !bedtime.IsZero() && t.Before(bedtime) && !t.Before(bedtime.Add(-NightRamp)) {
+			return 1 - ramp(bedtime.Sub(t))
+		}
+	}
+	return 0
+}
+
+// Sun gives sunrise and sunset on the day of t, in t's location, from the
+// sunrise equation.  Where the sun doesn't set that day they are 12 hours
+// either side of noon, and where it doesn't rise both are noon.
+func Sun(day time.Time, latitude, longitude float64) (rise, set time.Time) {
+	const rad = math.Pi / 180
+	noonUTC := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, time.UTC)
+	j2000 := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	n := math.Round(noonUTC.Sub(j2000).Hours()/24 - longitude/360) // Days since 2000 at local noon
+	m := math.Mod(357.5291+0.98560028*(n-longitude/360), 360)      // Mean anomaly
+	c := 1.9148*math.Sin(m*rad) + 0.02*math.Sin(2*m*rad) + 0.0003*math.Sin(3*m*rad)
+	lambda := math.Mod(m+c+180+102.9372, 360) // Ecliptic longitude
+	transit := n - longitude/360 + 0.0053*math.Sin(m*rad) - 0.0069*math.Sin(2*lambda*rad)
+	declination := math.Asin(math.Sin(lambda*rad) * math.Sin(23.4397*rad))
+	// The sun's centre 0.833 degrees below the horizon, for refraction and its size
+	cosH := (math.Sin(-0.833*rad) - math.Sin(latitude*rad)*math.Sin(declination)) /
+		(math.Cos(latitude*rad) * math.Cos(declination))
+	at := func(days float64) time.Time {
+		return j2000.Add(time.Duration(days * 24 * float64(time.Hour))).In(day.Location()).Round(time.Second)
+	}
+	h := math.Acos(min(max(cosH, -1), 1)) / rad / 360 // Days from noon
+	return at(transit - h), at(transit + h)
+}
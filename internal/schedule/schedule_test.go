@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSun(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	rise, set := Sun(time.Date(2024, 6, 21, 0, 0, 0, 0, london), 51.5074, -0.1278)
+	for _, c := range []struct {
+		name      string
+		got, want time.Time
+	}{
+		{"sunrise", rise, time.Date(2024, 6, 21, 4, 43, 0, 0, london)},
+		{"sunset", set, time.Date(2024, 6, 21, 21, 21, 0, 0, london)},
+	} {
+		if d := c.got.Sub(c.want); d < -3*time.Minute || d > 3*time.Minute {
+			t.Errorf("%s %v, want about %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestOn(t *testing.T) {
+	weekday, err := ParseWindows("07:00-08:30, 17:00-01:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekend, err := ParseWindows("sunrise-1h-sunset+2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Schedule{Weekday: weekday, Weekend: weekend, Latitude: 51.5, Longitude: 0, HasPlace: true}
+	for _, c := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2024, 6, 19, 6, 59, 0, 0, time.UTC), false}, // Wednesday
+		{time.Date(2024, 6, 19, 7, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 6, 19, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 6, 19, 23, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 6, 20, 0, 30, 0, 0, time.UTC), true}, // From the evening before
+		{time.Date(2024, 6, 20, 1, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 6, 22, 0, 30, 0, 0, time.UTC), true},   // Friday night runs into Saturday
+		{time.Date(2024, 6, 22, 3, 0, 0, 0, time.UTC), true},    // An hour before sunrise
+		{time.Date(2024, 6, 22, 12, 0, 0, 0, time.UTC), true},   // Saturday
+		{time.Date(2024, 6, 22, 23, 30, 0, 0, time.UTC), false}, // Two hours after sunset is past
+	} {
+		if got := s.On(c.at); got != c.want {
+			t.Errorf("on at %v is %v, want %v", c.at.Format("Mon 15:04"), got, c.want)
+		}
+	}
+	var always *Schedule
+	if !always.On(time.Now()) {
+		t.Error("no schedule is off")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SCHEDULE_WEEKDAY", "07:00-sunset")
+	if _, err := FromEnv(); err == nil {
+		t.Error("sunset without a place accepted")
+	}
+	t.Setenv("LATITUDE", "51.5")
+	t.Setenv("LONGITUDE", "-0.1")
+	s, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Weekend) != 1 || s.Weekend[0].To.Sun != "sunset" {
+		t.Errorf("weekend %v isn't the weekday's", s.Weekend)
+	}
+	t.Setenv("SCHEDULE_WEEKDAY", "7-23")
+	if _, err := FromEnv(); err == nil {
+		t.Error("7-23 accepted")
+	}
+}
+
+func TestNight(t *testing.T) {
+	windows, _ := ParseWindows("07:00-08:30,17:00-23:00")
+	s := &Schedule{Weekday: windows, Weekend: windows}
+	for _, c := range []struct {
+		hour, minute int
+		want         float64
+	}{
+		{8, 0, 0}, // Not the last window of the day
+		{21, 59, 0},
+		{22, 30, 0.5},
+		{23, 30, 1}, // Woken after bedtime
+		{7, 0, 0},
+	} {
+		at := time.Date(2024, 6, 19, c.hour, c.minute, 0, 0, time.UTC)
+		if got := s.Night(at); got != c.want {
+			t.Errorf("night at %s is %v, want %v", at.Format("15:04"), got, c.want)
+		}
+	}
+
+	s = &Schedule{Latitude: 51.5, HasPlace: true}
+	_, set := Sun(time.Date(2024, 6, 19, 0, 0, 0, 0, time.UTC), 51.5, 0)
+	for _, c := range []struct {
+		after time.Duration
+		want  float64
+	}{{-time.Minute, 0}, {30 * time.Minute, 0.5}, {2 * time.Hour, 1}} {
+		if got := s.Night(set.Add(c.after)); got != c.want {
+			t.Errorf("night %v after sunset is %v, want %v", c.after, got, c.want)
+		}
+	}
+	if !s.On(set.Add(3 * time.Hour)) {
+		t.Error("a place without windows is off")
+	}
+	var none *Schedule
+	if none.Night(set.Add(3*time.Hour)) != 0 {
+		t.Error("no schedule has a night")
+	}
+}
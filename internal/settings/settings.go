@@ -0,0 +1,232 @@
+// Package settings holds what can be changed while the frame is running, from
+// the web settings page.  They start from the environment and are saved in
+// the gokrazy permanent partition so they survive a restart, where they take
+// precedence over the environment.
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/audience"
+)
+
+// Where settings are kept unless SETTINGS_FILE says otherwise
+const DefaultFile = "/perm/gophoto/settings.json"
+
+// Playlist is where the photos come from.  Photos in any of the albums, with
+// any of the labels or of any of the people are shown.
+type Playlist struct {
+	Albums []string `json:"albums,omitempty"` // Album UIDs
+	Labels []string `json:"labels,omitempty"` // Label slugs
+	People []string `json:"people,omitempty"` // Subject UIDs
+}
+
+// Empty is true if the playlist has no sources, which shows everything
+func (p Playlist) Empty() bool {
+	return len(p.Albums) == 0 && len(p.Labels) == 0 && len(p.People) == 0
+}
+
+func (p Playlist) Equal(q Playlist) bool {
+	return slices.Equal(p.Albums, q.Albums) && slices.Equal(p.Labels, q.Labels) && slices.Equal(p.People, q.People)
+}
+
+// Settings for the slideshow
+type Settings struct {
+	Playlist Playlist `json:"playlist"`
+	Interval Seconds  `json:"interval,omitempty"` // Between photos
+	Fit      string   `json:"fit,omitempty"`      // fit or fill, see FIT_MODE
+	Layout   string   `json:"layout,omitempty"`   // The overlays, see LAYOUT
+	Colour   Colour   `json:"colour"`
+
+	Audiences []audience.Audience `json:"audiences,omitempty"`
+	Audience  string              `json:"audience,omitempty"` // Name of the one looking, everyone if empty
+}
+
+// ActiveAudience gives the audience looking now, one with no rules if there
+// isn't one.
+func (s Settings) ActiveAudience() audience.Audience {
+	for _, a := range s.Audiences {
+		if a.Name == s.Audience {
+			return a
+		}
+	}
+	return audience.Audience{}
+}
+
+// Colour adjusts the picture to suit the room.  Zero leaves each alone.
+type Colour struct {
+	Brightness int     `json:"brightness,omitempty"` // Percent, the backlight if there is one
+	Contrast   int     `json:"contrast,omitempty"`   // Percent
+	Gamma      float64 `json:"gamma,omitempty"`
+	Night      int     `json:"night,omitempty"` // Colour temperature at night in kelvin, eg 3000
+}
+
+// Validate checks the colour adjustments are within reason
+func (c Colour) Validate() error {
+	switch {
+	case c.Brightness != 0 && (c.Brightness < 5 || c.Brightness > 100):
+		return fmt.Errorf("brightness %d%% should be from 5 to 100", c.Brightness)
+	case c.Contrast != 0 && (c.Contrast < 50 || c.Contrast > 200):
+		return fmt.Errorf("contrast %d%% should be from 50 to 200", c.Contrast)
+	case c.Gamma != 0 && (c.Gamma < 0.3 || c.Gamma > 3):
+		return fmt.Errorf("gamma %v should be from 0.3 to 3", c.Gamma)
+	case c.Night != 0 && (c.Night < 1500 || c.Night > 6500):
+		return fmt.Errorf("night colour temperature %dK should be from 1500 to 6500", c.Night)
+	}
+	return nil
+}
+
+// Seconds is a duration kept as a number of seconds in JSON
+type Seconds time.Duration
+
+func (s Seconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(s).Seconds())
+}
+
+func (s *Seconds) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*s = Seconds(f * float64(time.Second))
+	return nil
+}
+
+// Validate checks the settings make sense
+func (s Settings) Validate() error {
+	if s.Interval != 0 && time.Duration(s.Interval) < 5*time.Second {
+		return fmt.Errorf("interval %v is shorter than 5s", time.Duration(s.Interval))
+	}
+	if s.Fit != "" && s.Fit != "fit" && s.Fit != "fill" {
+		return fmt.Errorf("fit %q should be fit or fill", s.Fit)
+	}
+	if err := s.Colour.Validate(); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, a := range s.Audiences {
+		if err := a.Validate(); err != nil {
+			return err
+		}
+		if names[a.Name] {
+			return fmt.Errorf("there are two audiences called %s", a.Name)
+		}
+		names[a.Name] = true
+	}
+	if s.Audience != "" && !names[s.Audience] {
+		return fmt.Errorf("there is no audience called %s", s.Audience)
+	}
+	return nil
+}
+
+// FromEnv makes settings from the environment as it was before there were
+// settings: ALBUM_UID, FIT_MODE and LAYOUT.
+func FromEnv() Settings {
+	var s Settings
+	if album := os.Getenv("ALBUM_UID"); album != "" {
+		s.Playlist.Albums = []string{album}
+	}
+	if strings.EqualFold(os.Getenv("FIT_MODE"), "fill") {
+		s.Fit = "fill"
+	}
+	s.Layout = os.Getenv("LAYOUT")
+	return s
+}
+
+var (
+	mu      sync.Mutex
+	current Settings
+	file    string
+	changed = make(chan struct{}, 1)
+)
+
+// Load reads the saved settings, if there are none those from the
+// environment are used.
+func Load() Settings {
+	mu.Lock()
+	defer mu.Unlock()
+	file = os.Getenv("SETTINGS_FILE")
+	if file == "" {
+		file = DefaultFile
+	}
+	current = FromEnv()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Reading settings: %v", err)
+		}
+		return current
+	}
+	var saved Settings
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Settings %s: %v", file, err)
+		return current
+	}
+	if err := saved.Validate(); err != nil {
+		log.Printf("Settings %s: %v", file, err)
+		return current
+	}
+	current = saved
+	return current
+}
+
+// Current gives the settings now
+func Current() Settings {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Set saves new settings and signals Changed so they are used straight away
+func Set(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := save(file, s); err != nil {
+		return err
+	}
+	current = s
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Changed signals when the settings have been changed
+func Changed() <-chan struct{} {
+	return changed
+}
+
+// Writes the settings to a temporary file and renames it, so a power cut
+// can't leave half a file
+func save(name string, s Settings) error {
+	if name == "" {
+		name = DefaultFile
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("saving settings: %v", err)
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("saving settings: %v", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("saving settings: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package settings
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/audience"
+)
+
+func TestSettingsSaved(t *testing.T) {
+	t.Setenv("SETTINGS_FILE", filepath.Join(t.TempDir(), "gophoto", "settings.json"))
+	t.Setenv("ALBUM_UID", "aq1")
+	t.Setenv("FIT_MODE", "fill")
+	t.Setenv("LAYOUT", "clock")
+
+	s := Load()
+	want := Settings{Playlist: Playlist{Albums: []string{"aq1"}}, Fit: "fill", Layout: "clock"}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("from the environment %+v, want %+v", s, want)
+	}
+
+	s.Playlist = Playlist{Albums: []string{"aq1", "aq2"}, Labels: []string{"beach"}, People: []string{"js1"}}
+	s.Interval = Seconds(30 * time.Second)
+	s.Fit = "fit"
+	s.Audiences = []audience.Audience{{Name: "guests", Exclude: audience.Rules{Private: true, People: []string{"js1"}}}}
+	s.Audience = "guests"
+	if err := Set(s); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-Changed():
+	default:
+		t.Error("no change signalled")
+	}
+
+	// Saved settings win over the environment
+	if got := Load(); !reflect.DeepEqual(got, s) {
+		t.Errorf("loaded %+v, want %+v", got, s)
+	}
+
+	if err := Set(Settings{Interval: Seconds(time.Second)}); err == nil {
+		t.Error("saved a 1s interval")
+	}
+	if err := Set(Settings{Audience: "family"}); err == nil {
+		t.Error("saved an audience that doesn't exist")
+	}
+	if got := Current(); !reflect.DeepEqual(got, s) {
+		t.Errorf("bad settings changed the current ones to %+v", got)
+	}
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/drummonds/gophoto/internal/audience"
+	"github.com/drummonds/gophoto/internal/frame"
+	"github.com/drummonds/gophoto/internal/settings"
+)
+
+// Rules as a part of an audience's form
+type rulesForm struct {
+	Prefix                 string // Of the form fields, include. or exclude.
+	Albums, Labels, People []sourceChoice
+	audience.Rules
+}
+
+// An audience as a form, the new one has no name
+type audienceForm struct {
+	Name             string
+	Active           bool
+	Include, Exclude rulesForm
+}
+
+// What can be chosen from for the rules, listed once for the page
+type sourceLists struct {
+	albums, labels, people []frame.Source
+	errs                   []error
+}
+
+func listSources(ctx context.Context) sourceLists {
+	var l sourceLists
+	for _, list := range []struct {
+		dst  *[]frame.Source
+		list func(context.Context) ([]frame.Source, error)
+	}{{&l.albums, library.albums}, {&l.labels, library.labels}, {&l.people, library.people}} {
+		var err error
+		if *list.dst, err = list.list(ctx); err != nil {
+			log.Printf("Audiences: %v", err)
+			l.errs = append(l.errs, err)
+		}
+	}
+	return l
+}
+
+func (l sourceLists) rulesForm(prefix string, r audience.Rules) rulesForm {
+	return rulesForm{Prefix: prefix, Rules: r,
+		Albums: choices(l.albums, r.Albums), Labels: choices(l.labels, r.Labels), People: choices(l.people, r.People)}
+}
+
+var audiencesTemplate = template.Must(template.New("audiences").Parse(`<!DOCTYPE html>
+<html><head><title>gophoto audiences</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+body{font-family:sans-serif;max-width:60em;margin:auto;padding:1em}
+fieldset{margin:1em 0}
+.rules{display:inline-block;vertical-align:top;margin-right:2em}
+select[multiple]{min-width:12em}
+.active{border-color:#080;border-width:3px}
+.error{color:#a00}
+</style></head><body>
+<h1>Audiences</h1>
+<p>An audience is who is looking at the frame.  It sees the photos that match
+its include rules, all of them if there are none, but none that match its
+exclude rules.  Photos match the albums, labels and people if they are in any
+of them.</p>
+{{if .Saved}}<p>Saved, the frame is using them now.</p>{{end}}
+{{range .Errs}}<p class="error">{{.}}</p>{{end}}
+<form method="post"><p>
+{{if .Everyone}}Everyone is looking, all photos are shown.
+{{else}}<button name="do" value="use">Show to everyone</button>{{end}}
+</p></form>
+{{define "rules"}}<div class="rules"><h3>{{if eq .Prefix "include."}}Include{{else}}Exclude{{end}}</h3>
+{{$p := .Prefix}}
+<p><select name="{{$p}}albums" multiple size="5" title="Albums">{{range .Albums}}<option value="{{.UID}}"{{if .Checked}} selected{{end}}>{{.Title}}</option>{{end}}</select>
+<select name="{{$p}}labels" multiple size="5" title="Labels">{{range .Labels}}<option value="{{.UID}}"{{if .Checked}} selected{{end}}>{{.Title}}</option>{{end}}</select>
+<select name="{{$p}}people" multiple size="5" title="People">{{range .People}}<option value="{{.UID}}"{{if .Checked}} selected{{end}}>{{.Title}}</option>{{end}}</select></p>
+<p><label><input type="checkbox" name="{{$p}}private"{{if .Private}} checked{{end}}> Private photos</label></p>
+<p>Taken from <input type="date" name="{{$p}}from" value="{{.From}}"> to <input type="date" name="{{$p}}to" value="{{.To}}"></p>
+</div>{{end}}
+{{range .Audiences}}
+<form method="post"><fieldset{{if .Active}} class="active"{{end}}>
+<legend>{{if .Name}}{{.Name}}{{if .Active}}, looking now{{end}}{{else}}New audience{{end}}</legend>
+<input type="hidden" name="original" value="{{.Name}}">
+<p>Name <input name="name" value="{{.Name}}" required></p>
+{{template "rules" .Include}}{{template "rules" .Exclude}}
+<p><button name="do" value="save">Save</button>
+{{if .Name}}{{if not .Active}}<button name="do" value="use">Show to {{.Name}}</button>{{end}}
+<button name="do" value="delete" onclick="return confirm('Delete {{.Name}}?')">Delete</button>{{end}}</p>
+</fieldset></form>
+{{end}}
+<p><a href="/settings">Settings</a> <a href="/remote">Remote</a></p>
+</body></html>
+`))
+
+type audiencesPage struct {
+	Audiences []audienceForm
+	Everyone  bool
+	Saved     bool
+	Errs      []error
+}
+
+// Reads an audience's rules from its form
+func parseRules(r *http.Request, prefix string) audience.Rules {
+	return audience.Rules{
+		Albums:  r.PostForm[prefix+"albums"],
+		Labels:  r.PostForm[prefix+"labels"],
+		People:  r.PostForm[prefix+"people"],
+		Private: r.PostForm.Get(prefix+"private") != "",
+		From:    r.PostForm.Get(prefix + "from"),
+		To:      r.PostForm.Get(prefix + "to"),
+	}
+}
+
+// Changes the settings as asked by one of the forms: save an audience, delete
+// it or make it the one looking, which is everyone without a name.
+func changeAudiences(r *http.Request, s settings.Settings) (settings.Settings, error) {
+	if err := r.ParseForm(); err != nil {
+		return s, err
+	}
+	s.Audiences = slices.Clone(s.Audiences)
+	original, name := r.PostForm.Get("original"), r.PostForm.Get("name")
+	i := slices.IndexFunc(s.Audiences, func(a audience.Audience) bool { return a.Name == original })
+	if original != "" && i < 0 {
+		return s, fmt.Errorf("there is no audience called %s", original)
+	}
+	switch r.PostForm.Get("do") {
+	case "save":
+		a := audience.Audience{Name: name, Include: parseRules(r, "include."), Exclude: parseRules(r, "exclude.")}
+		if i < 0 {
+			s.Audiences = append(s.Audiences, a)
+		} else {
+			s.Audiences[i] = a
+		}
+		if original != "" && s.Audience == original {
+			s.Audience = name // Renamed
+		}
+	case "delete":
+		if i >= 0 {
+			s.Audiences = slices.Delete(s.Audiences, i, i+1)
+		}
+		if s.Audience == original {
+			s.Audience = ""
+		}
+	case "use":
+		s.Audience = original
+	default:
+		return s, fmt.Errorf("unknown change %q", r.PostForm.Get("do"))
+	}
+	return s, s.Validate()
+}
+
+func audiencesHandler(w http.ResponseWriter, r *http.Request) {
+	page := audiencesPage{Saved: r.URL.Query().Has("saved")}
+	s := settings.Current()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		changed, err := changeAudiences(r, s)
+		if err == nil {
+			err = settings.Set(changed)
+		}
+		if err == nil {
+			http.Redirect(w, r, "/audiences?saved", http.StatusSeeOther)
+			return
+		}
+		page.Errs = append(page.Errs, err)
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		http.Error(w, "Use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lists := listSources(r.Context())
+	page.Errs = append(page.Errs, lists.errs...)
+	page.Everyone = s.Audience == ""
+	for _, a := range append(s.Audiences, audience.Audience{}) {
+		page.Audiences = append(page.Audiences, audienceForm{
+			Name:    a.Name,
+			Active:  a.Name != "" && a.Name == s.Audience,
+			Include: lists.rulesForm("include.", a.Include),
+			Exclude: lists.rulesForm("exclude.", a.Exclude),
+		})
+	}
+	if err := audiencesTemplate.Execute(w, page); err != nil {
+		log.Printf("Audiences page: %v", err)
+	}
+}
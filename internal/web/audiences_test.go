@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drummonds/gophoto/internal/audience"
+	"github.com/drummonds/gophoto/internal/frame"
+	"github.com/drummonds/gophoto/internal/settings"
+)
+
+func TestAudiencesPage(t *testing.T) {
+	t.Setenv("SETTINGS_FILE", filepath.Join(t.TempDir(), "settings.json"))
+	settings.Load()
+	none := func(context.Context) ([]frame.Source, error) { return nil, nil }
+	library.albums, library.labels = none, none
+	library.people = func(context.Context) ([]frame.Source, error) {
+		return []frame.Source{{UID: "js1", Title: "Jo"}, {UID: "js2", Title: "Sam"}}, nil
+	}
+	post := func(form url.Values) int {
+		req := httptest.NewRequest("POST", "/audiences", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		audiencesHandler(w, req)
+		return w.Code
+	}
+
+	if code := post(url.Values{"do": {"save"}, "name": {"guests"}, "exclude.people": {"js2"}, "exclude.private": {"on"}}); code != http.StatusSeeOther {
+		t.Fatalf("adding: status %d", code)
+	}
+	if code := post(url.Values{"do": {"use"}, "original": {"guests"}}); code != http.StatusSeeOther {
+		t.Fatalf("using: status %d", code)
+	}
+	s := settings.Current()
+	want := audience.Audience{Name: "guests", Exclude: audience.Rules{People: []string{"js2"}, Private: true}}
+	if a := s.ActiveAudience(); s.Audience != "guests" || a.Name != want.Name || !a.Exclude.Private || len(a.Exclude.People) != 1 {
+		t.Errorf("audience is %q %+v, want %+v", s.Audience, a, want)
+	}
+
+	w := httptest.NewRecorder()
+	audiencesHandler(w, httptest.NewRequest("GET", "/audiences", nil))
+	for _, s := range []string{`guests, looking now`, `<option value="js2" selected>Sam</option>`, `New audience`} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("page is missing %s", s)
+		}
+	}
+
+	if code := post(url.Values{"do": {"save"}, "original": {"guests"}, "name": {"visitors"}, "include.from": {"2024-13-01"}}); code != http.StatusBadRequest {
+		t.Errorf("bad date: status %d", code)
+	}
+	if code := post(url.Values{"do": {"save"}, "original": {"guests"}, "name": {"visitors"}}); code != http.StatusSeeOther {
+		t.Errorf("renaming: status %d", code)
+	}
+	if s := settings.Current(); s.Audience != "visitors" {
+		t.Errorf("renamed audience isn't looking, %q is", s.Audience)
+	}
+	if code := post(url.Values{"do": {"delete"}, "original": {"visitors"}}); code != http.StatusSeeOther {
+		t.Errorf("deleting: status %d", code)
+	}
+	if s := settings.Current(); s.Audience != "" || len(s.Audiences) != 0 {
+		t.Errorf("after deleting %+v", s)
+	}
+}
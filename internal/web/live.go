@@ -0,0 +1,145 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// Defaults for the live view, LIVE_FPS and LIVE_WIDTH change them and so
+// do fps and width in the URL.
+const (
+	defaultLiveFPS   = 2
+	defaultLiveWidth = 640
+	maxLiveFPS       = 25
+)
+
+// Copy of what is on the screen, kept up to date by PublishFrame
+var live struct {
+	sync.RWMutex
+	frame *image.RGBA
+	seq   int // Changes whenever frame does
+}
+
+// PublishFrame keeps a copy of the frame for the live view.  Only the
+// damaged rectangles are copied, all of it if there are none.
+func PublishFrame(img *image.RGBA, damage ...image.Rectangle) {
+	live.Lock()
+	defer live.Unlock()
+	if live.frame == nil || live.frame.Rect != img.Rect {
+		live.frame = image.NewRGBA(img.Rect)
+		damage = nil
+	}
+	if len(damage) == 0 {
+		damage = []image.Rectangle{img.Rect}
+	}
+	for _, r := range damage {
+		draw.Copy(live.frame, r.Min, img, r, draw.Src, nil)
+	}
+	live.seq++
+}
+
+// Takes a scaled copy of the frame if it has changed since seq
+func liveSnapshot(dst *image.RGBA, width, seq int) (*image.RGBA, int) {
+	live.RLock()
+	defer live.RUnlock()
+	if live.frame == nil || live.seq == seq {
+		return dst, seq
+	}
+	src := live.frame.Rect
+	if width <= 0 || width > src.Dx() {
+		width = src.Dx()
+	}
+	size := image.Rect(0, 0, width, src.Dy()*width/src.Dx())
+	if dst == nil || dst.Rect != size {
+		dst = image.NewRGBA(size)
+	}
+	draw.ApproxBiLinear.Scale(dst, size, live.frame, src, draw.Src, nil)
+	return dst, live.seq
+}
+
+// An integer setting from the URL, else the environment, else def
+func liveSetting(r *http.Request, param, env string, def int) int {
+	s := r.URL.Query().Get(param)
+	if s == "" {
+		s = os.Getenv(env)
+	}
+	if v, err := strconv.Atoi(s); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// Streams the frame as MJPEG, which browsers show in a plain img tag.  A
+// frame is only sent when the screen has changed.
+func liveStreamHandler(w http.ResponseWriter, r *http.Request) {
+	fps := min(liveSetting(r, "fps", "LIVE_FPS", defaultLiveFPS), maxLiveFPS)
+	width := liveSetting(r, "width", "LIVE_WIDTH", defaultLiveWidth)
+
+	const boundary = "gophotoframe"
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	out := bufio.NewWriter(w)
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+	var (
+		img  *image.RGBA
+		seq  = -1
+		jpg  bytes.Buffer
+		sent = -1
+	)
+	for {
+		img, seq = liveSnapshot(img, width, seq)
+		if img != nil && seq != sent {
+			jpg.Reset()
+			if err := jpeg.Encode(&jpg, img, &jpeg.Options{Quality: 80}); err != nil {
+				log.Printf("Live view: %v", err)
+				return
+			}
+			fmt.Fprintf(out, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, jpg.Len())
+			out.Write(jpg.Bytes())
+			out.WriteString("\r\n")
+			if err := out.Flush(); err != nil {
+				return // Viewer has gone
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			sent = seq
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var liveTemplate = template.Must(template.New("live").Parse(`<!DOCTYPE html>
+<html><head><title>gophoto live</title>
+<style>body{margin:0;background:#000}img{display:block;max-width:100%;max-height:100vh;margin:auto}</style>
+</head><body><img src="{{.}}" alt="What the frame is showing"></body></html>
+`))
+
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	src := "/live.mjpeg"
+	if q := r.URL.Query(); len(q) > 0 {
+		src += "?" + q.Encode()
+	}
+	if err := liveTemplate.Execute(w, src); err != nil {
+		log.Printf("Live page: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLiveStream(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	draw.Draw(frame, frame.Rect, &image.Uniform{color.RGBA{0, 0, 255, 255}}, image.Point{}, draw.Src)
+	PublishFrame(frame)
+
+	srv := httptest.NewServer(http.HandlerFunc(liveStreamHandler))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"?width=160&fps=10", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "multipart/x-mixed-replace") {
+		t.Fatalf("content type %q", ct)
+	}
+
+	// Read the first part by hand as the stream never ends
+	r := bufio.NewReader(resp.Body)
+	if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "--") {
+		t.Fatalf("boundary %q", line)
+	}
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(header.Get("Content-Length"))
+	img, err := jpeg.Decode(io.LimitReader(r, int64(n)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 160 || img.Bounds().Dy() != 90 {
+		t.Errorf("live frame %v, want 160x90", img.Bounds())
+	}
+	if _, _, b, _ := img.At(80, 45).RGBA(); b>>8 < 200 {
+		t.Errorf("live frame colour %v, want blue", img.At(80, 45))
+	}
+}
+
+func TestLivePageEscapes(t *testing.T) {
+	w := httptest.NewRecorder()
+	liveHandler(w, httptest.NewRequest("GET", `/live?fps=5&x="><script>alert(1)</script>`, nil))
+	page := w.Body.String()
+	if strings.Contains(page, "<script>") || strings.Count(page, `"`) != 4 {
+		t.Errorf("query not escaped: %s", page)
+	}
+	if !strings.Contains(page, "/live.mjpeg?fps=5") {
+		t.Errorf("fps not passed on to the stream: %s", page)
+	}
+}
@@ -0,0 +1,181 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/control"
+)
+
+// Commands from the remote, read by the main loop
+var commands = make(chan control.Command, 10)
+
+// Commands gives what has been asked for on the web remote
+func Commands() <-chan control.Command {
+	return commands
+}
+
+var (
+	stateMu sync.Mutex
+	state   control.State
+)
+
+// SetState tells the remote how the slideshow is going
+func SetState(s control.State) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state = s
+}
+
+// State as JSON, the interval in seconds
+type stateJSON struct {
+	Paused    bool    `json:"paused"`
+	Interval  float64 `json:"interval"`
+	UID       string  `json:"uid,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Favourite bool    `json:"favourite"`
+	Rating    int     `json:"rating"`
+	Audience  string  `json:"audience,omitempty"`
+	Blanked   bool    `json:"blanked"`
+}
+
+func writeState(w http.ResponseWriter, status int) {
+	stateMu.Lock()
+	s := stateJSON{Paused: state.Paused, Interval: state.Interval.Seconds(), UID: state.UID, Title: state.Title,
+		Favourite: state.Favourite, Rating: state.Rating, Audience: state.Audience, Blanked: state.Blanked}
+	stateMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(s)
+}
+
+// Reads a command from a request to /api/<action>.  The interval is given
+// as seconds, how long to wake for as minutes and the photo to show as uid,
+// in the query or a form.
+func parseCommand(r *http.Request) (control.Command, error) {
+	action, err := control.ParseAction(strings.TrimPrefix(r.URL.Path, "/api/"))
+	if err != nil {
+		return control.Command{}, err
+	}
+	c := control.Command{Action: action, UID: r.FormValue("uid")}
+	if action == control.SetInterval {
+		seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+		if err != nil {
+			return c, fmt.Errorf("interval needs seconds: %v", err)
+		}
+		c.Interval = time.Duration(seconds * float64(time.Second))
+	}
+	if action == control.Wake && r.FormValue("minutes") != "" {
+		minutes, err := strconv.ParseFloat(r.FormValue("minutes"), 64)
+		if err != nil {
+			return c, fmt.Errorf("wake needs minutes: %v", err)
+		}
+		c.Interval = time.Duration(minutes * float64(time.Minute))
+	}
+	if action == control.Rate {
+		if c.Rating, err = strconv.Atoi(r.FormValue("rating")); err != nil {
+			return c, fmt.Errorf("rate needs a rating: %v", err)
+		}
+	}
+	return c, c.Validate()
+}
+
+// The REST remote.  GET /api/status gives the state, POST /api/next,
+// previous, pause, resume, interval?seconds=30 or show?uid=... steer the
+// slideshow.  POST /api/favourite, like, dislike, rate?rating=4 or hide say
+// what you think of the photo on the screen, given a uid they only do so
+// if it is still that photo.  POST /api/wake or wake?minutes=90 turns the
+// screen on when it is blanked for the night.
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/status" {
+		writeState(w, http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "commands must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, err := parseCommand(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case commands <- c:
+	default:
+		http.Error(w, "too many commands waiting", http.StatusServiceUnavailable)
+		return
+	}
+	writeState(w, http.StatusAccepted)
+}
+
+// Buttons for the REST remote with the live view above them
+const remotePage = `<!DOCTYPE html>
+<html><head><title>gophoto remote</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+body{font-family:sans-serif;max-width:40em;margin:auto;padding:1em}
+img{width:100%;background:#000}
+button{font-size:1.2em;margin:.2em}
+</style></head><body>
+<img src="/live.mjpeg?width=640" alt="What the frame is showing">
+<p id="state"></p>
+<p>
+<button onclick="send('previous')">&#9664; Previous</button>
+<button onclick="send('pause')">Pause</button>
+<button onclick="send('resume')">Resume</button>
+<button onclick="send('next')">Next &#9654;</button>
+<button id="wake" onclick="send('wake')" hidden>Wake screen</button>
+</p>
+<p>
+<button id="favourite" onclick="judge('favourite')">&#9825; Favourite</button>
+<button onclick="judge('like')">&#128077; Like</button>
+<button onclick="judge('dislike')">&#128078; Dislike</button>
+<select id="rating" onchange="judge('rate', {rating: this.value})">
+<option value="0">Not rated</option><option>1</option><option>2</option><option>3</option><option>4</option><option>5</option>
+</select>
+<button onclick="if (confirm('Never show this photo again?')) judge('hide')">Hide</button>
+</p>
+<p><a href="/settings">Settings</a> <a href="/audiences">Audiences</a></p>
+<form onsubmit="send('interval', {seconds: this.seconds.value}); return false">
+Show each photo for <input name="seconds" type="number" min="5" size="4"> seconds <button>Set</button>
+</form>
+<form onsubmit="send('show', {uid: this.uid.value}); return false">
+Show photo <input name="uid" placeholder="PhotoPrism UID"> <button>Show</button>
+</form>
+<script>
+var current = {};
+function show(s) {
+  current = s;
+  document.getElementById("favourite").innerHTML = (s.favourite ? "&#9829;" : "&#9825;") + " Favourite";
+  document.getElementById("rating").value = s.rating;
+  document.getElementById("wake").hidden = !s.blanked;
+  document.getElementById("state").textContent = s.blanked ? "Screen off for the night" :
+    (s.paused ? "Paused" : "Changing every " + s.interval + "s") + (s.title ? ", showing " + s.title : "") +
+    (s.audience ? " to " + s.audience : "");
+  document.forms[0].seconds.placeholder = s.interval;
+}
+function send(action, params) {
+  fetch("/api/" + action, {method: "POST", body: new URLSearchParams(params || {})})
+    .then(r => r.ok ? r.json().then(show) : r.text().then(alert));
+}
+// Opinions of the photo being shown, if it hasn't changed in the meantime
+function judge(action, params) {
+  send(action, Object.assign({uid: current.uid || ""}, params));
+}
+function poll() { fetch("/api/status").then(r => r.json()).then(show); }
+poll();
+setInterval(poll, 2000);
+</script>
+</body></html>
+`
+
+func remoteHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, remotePage)
+}
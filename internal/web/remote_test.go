@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/control"
+)
+
+func TestAPICommands(t *testing.T) {
+	post := func(path string, form url.Values) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		apiHandler(w, req)
+		return w.Code
+	}
+	for _, tc := range []struct {
+		path string
+		form url.Values
+		want control.Command
+	}{
+		{"/api/next", nil, control.Command{Action: control.Next}},
+		{"/api/interval", url.Values{"seconds": {"30"}}, control.Command{Action: control.SetInterval, Interval: 30 * time.Second}},
+		{"/api/show", url.Values{"uid": {"pt1234"}}, control.Command{Action: control.Show, UID: "pt1234"}},
+		{"/api/rate", url.Values{"uid": {"pt1234"}, "rating": {"4"}}, control.Command{Action: control.Rate, UID: "pt1234", Rating: 4}},
+		{"/api/hide", nil, control.Command{Action: control.Hide}},
+		{"/api/wake", url.Values{"minutes": {"90"}}, control.Command{Action: control.Wake, Interval: 90 * time.Minute}},
+	} {
+		if code := post(tc.path, tc.form); code != http.StatusAccepted {
+			t.Errorf("%s: status %d", tc.path, code)
+			continue
+		}
+		if got := <-Commands(); got != tc.want {
+			t.Errorf("%s: command %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	for _, path := range []string{"/api/rewind", "/api/interval", "/api/show", "/api/rate"} {
+		if code := post(path, url.Values{"seconds": {"1"}}); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", path, code, http.StatusBadRequest)
+		}
+	}
+	w := httptest.NewRecorder()
+	apiHandler(w, httptest.NewRequest("GET", "/api/next", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET a command: status %d", w.Code)
+	}
+	if len(commands) != 0 {
+		t.Errorf("%d bad commands were queued", len(commands))
+	}
+}
@@ -0,0 +1,228 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/frame"
+	"github.com/drummonds/gophoto/internal/settings"
+)
+
+// What can be picked for the playlist, a variable so tests needn't talk to
+// PhotoPrism
+var library = struct {
+	albums, labels, people func(context.Context) ([]frame.Source, error)
+}{frame.Albums, frame.Labels, frame.People}
+
+// A source as a checkbox on the settings page
+type sourceChoice struct {
+	frame.Source
+	Checked bool
+}
+
+// One group of sources such as the albums
+type sourceGroup struct {
+	Name    string // Form field
+	Title   string
+	Choices []sourceChoice
+	Err     error
+}
+
+// Lists the sources with those in the playlist ticked.  Anything in the
+// playlist that isn't listed, say because PhotoPrism is down, is still shown
+// so saving doesn't lose it.
+func newSourceGroup(ctx context.Context, name, title string, list func(context.Context) ([]frame.Source, error), selected []string) sourceGroup {
+	g := sourceGroup{Name: name, Title: title}
+	sources, err := list(ctx)
+	if err != nil {
+		log.Printf("Settings: %v", err)
+		g.Err = err
+	}
+	g.Choices = choices(sources, selected)
+	return g
+}
+
+// The sources with those selected marked, adding any selected that aren't
+// among them
+func choices(sources []frame.Source, selected []string) []sourceChoice {
+	var choices []sourceChoice
+	for _, s := range sources {
+		choices = append(choices, sourceChoice{Source: s, Checked: slices.Contains(selected, s.UID)})
+	}
+	for _, uid := range selected {
+		if !slices.ContainsFunc(sources, func(s frame.Source) bool { return s.UID == uid }) {
+			choices = append(choices, sourceChoice{Source: frame.Source{UID: uid, Title: uid}, Checked: true})
+		}
+	}
+	return choices
+}
+
+var settingsTemplate = template.Must(template.New("settings").Parse(`<!DOCTYPE html>
+<html><head><title>gophoto settings</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+body{font-family:sans-serif;max-width:60em;margin:auto;padding:1em}
+.sources{display:flex;flex-wrap:wrap;gap:.5em}
+.sources label{width:110px;text-align:center;font-size:.8em}
+.sources img{width:100px;height:100px;object-fit:cover;display:block;margin:auto;background:#ddd}
+.error{color:#a00}
+</style></head><body>
+<h1>Settings</h1>
+{{if .Saved}}<p>Saved, the frame is using them now.</p>{{end}}
+{{if .Err}}<p class="error">{{.Err}}</p>{{end}}
+<form method="post">
+<p>Show photos in any of the ticked albums, with any of the labels or of any
+of the people.  With nothing ticked all photos are shown.</p>
+{{range .Groups}}
+<h2>{{.Title}}</h2>
+{{if .Err}}<p class="error">{{.Err}}</p>{{end}}
+<div class="sources">
+{{$name := .Name}}{{range .Choices}}<label>
+{{if .Thumb}}<img src="/settings/thumb/{{.Thumb}}" alt="" loading="lazy">{{end}}
+<input type="checkbox" name="{{$name}}" value="{{.UID}}"{{if .Checked}} checked{{end}}> {{.Title}}{{if .Count}} ({{.Count}}){{end}}
+</label>
+{{end}}</div>
+{{end}}
+<h2>Slideshow</h2>
+<p>Show each photo for <input name="interval" type="number" min="5" size="4" value="{{.Interval}}" placeholder="15"> seconds</p>
+<p>Photos that aren't the shape of the screen
+<select name="fit">
+<option value="fit"{{if ne .Settings.Fit "fill"}} selected{{end}}>fit on a background</option>
+<option value="fill"{{if eq .Settings.Fit "fill"}} selected{{end}}>fill the screen, cropping</option>
+</select></p>
+<p>Layout
+<select name="layout">
+{{$layout := .Layout}}{{range .Layouts}}<option{{if eq . $layout}} selected{{end}}>{{.}}</option>
+{{end}}</select></p>
+<h2>Picture</h2>
+<p>To suit the room, leave them empty to show photos as they are.</p>
+{{with .Settings.Colour}}
+<p>Brightness <input name="brightness" type="number" min="5" max="100" size="4" value="{{if .Brightness}}{{.Brightness}}{{end}}" placeholder="100"> %,
+of the backlight if the screen has one</p>
+<p>Contrast <input name="contrast" type="number" min="50" max="200" size="4" value="{{if .Contrast}}{{.Contrast}}{{end}}" placeholder="100"> %</p>
+<p>Gamma <input name="gamma" type="number" min="0.3" max="3" step="0.1" size="4" value="{{if .Gamma}}{{.Gamma}}{{end}}" placeholder="1"></p>
+<p>At night warm white to <input name="night" type="number" min="1500" max="6500" step="100" size="5" value="{{if .Night}}{{.Night}}{{end}}" placeholder="6500">K,
+eg 3000 like a lamp.  It comes in over an hour after sunset, or before the screen's schedule ends.</p>
+{{end}}
+<p><button>Save</button> <a href="/remote">Remote</a> <a href="/audiences">Audiences</a></p>
+</form>
+</body></html>
+`))
+
+type settingsPage struct {
+	Settings settings.Settings
+	Groups   []sourceGroup
+	Interval string
+	Layout   string
+	Layouts  []string
+	Saved    bool
+	Err      error
+}
+
+// Reads settings from the settings form
+func parseSettings(r *http.Request) (settings.Settings, error) {
+	if err := r.ParseForm(); err != nil {
+		return settings.Settings{}, err
+	}
+	s := settings.Current() // Keeping the audiences
+	s.Playlist = settings.Playlist{Albums: r.PostForm["album"], Labels: r.PostForm["label"], People: r.PostForm["person"]}
+	s.Fit, s.Layout, s.Interval = r.PostForm.Get("fit"), r.PostForm.Get("layout"), 0
+	if v := strings.TrimSpace(r.PostForm.Get("interval")); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return s, err
+		}
+		s.Interval = settings.Seconds(seconds * float64(time.Second))
+	}
+	s.Colour = settings.Colour{}
+	for _, f := range []struct {
+		name string
+		int  *int
+		dst  *float64
+	}{
+		{name: "brightness", int: &s.Colour.Brightness}, {name: "contrast", int: &s.Colour.Contrast},
+		{name: "gamma", dst: &s.Colour.Gamma}, {name: "night", int: &s.Colour.Night},
+	} {
+		v := strings.TrimSpace(r.PostForm.Get(f.name))
+		if v == "" {
+			continue
+		}
+		var err error
+		if f.int != nil {
+			*f.int, err = strconv.Atoi(v)
+		} else {
+			*f.dst, err = strconv.ParseFloat(v, 64)
+		}
+		if err != nil {
+			return s, fmt.Errorf("%s %q isn't a number", f.name, v)
+		}
+	}
+	return s, s.Validate()
+}
+
+func settingsHandler(w http.ResponseWriter, r *http.Request) {
+	page := settingsPage{Settings: settings.Current(), Saved: r.URL.Query().Has("saved")}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		s, err := parseSettings(r)
+		if err == nil {
+			err = settings.Set(s)
+		}
+		if err == nil {
+			http.Redirect(w, r, "/settings?saved", http.StatusSeeOther)
+			return
+		}
+		page.Settings, page.Err = s, err
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		http.Error(w, "Use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := page.Settings
+	page.Groups = []sourceGroup{
+		newSourceGroup(r.Context(), "album", "Albums", library.albums, s.Playlist.Albums),
+		newSourceGroup(r.Context(), "label", "Labels", library.labels, s.Playlist.Labels),
+		newSourceGroup(r.Context(), "person", "People", library.people, s.Playlist.People),
+	}
+	if s.Interval != 0 {
+		page.Interval = strconv.FormatFloat(time.Duration(s.Interval).Seconds(), 'f', -1, 64)
+	}
+	page.Layout = s.Layout
+	if page.Layout == "" {
+		page.Layout = "photo"
+	}
+	page.Layouts = frame.Layouts()
+	if !slices.Contains(page.Layouts, page.Layout) {
+		page.Layouts = append(page.Layouts, page.Layout) // From a file
+	}
+	if err := settingsTemplate.Execute(w, page); err != nil {
+		log.Printf("Settings page: %v", err)
+	}
+}
+
+// Passes on PhotoPrism thumbnails for the settings page, as they need a
+// token the browser doesn't have
+func thumbHandler(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, "/settings/thumb/")
+	if hash == "" || strings.ContainsRune(hash, '/') {
+		http.NotFound(w, r)
+		return
+	}
+	jpg, err := frame.Thumbnail(r.Context(), hash, "tile_100")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(jpg)
+}
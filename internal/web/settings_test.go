@@ -0,0 +1,79 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drummonds/gophoto/internal/frame"
+	"github.com/drummonds/gophoto/internal/settings"
+)
+
+func TestSettingsPage(t *testing.T) {
+	t.Setenv("SETTINGS_FILE", filepath.Join(t.TempDir(), "settings.json"))
+	t.Setenv("ALBUM_UID", "")
+	settings.Load()
+	list := func(sources ...frame.Source) func(context.Context) ([]frame.Source, error) {
+		return func(context.Context) ([]frame.Source, error) { return sources, nil }
+	}
+	library.albums = list(frame.Source{UID: "as1", Title: "Holidays", Thumb: "abc", Count: 12}, frame.Source{UID: "as2", Title: "Garden"})
+	library.labels = list(frame.Source{UID: "cat", Title: "Cat"})
+	library.people = func(context.Context) ([]frame.Source, error) { return nil, errors.New("PhotoPrism is down") }
+
+	form := url.Values{"album": {"as2"}, "label": {"cat"}, "person": {"js1"}, "interval": {"30"}, "fit": {"fill"}, "layout": {"clock"},
+		"brightness": {"60"}, "contrast": {""}, "gamma": {"1.2"}, "night": {"3000"}}
+	req := httptest.NewRequest("POST", "/settings", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	settingsHandler(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("saving: status %d\n%s", w.Code, w.Body)
+	}
+	select {
+	case <-settings.Changed():
+	default:
+		t.Error("saving didn't signal a change")
+	}
+	want := settings.Settings{
+		Playlist: settings.Playlist{Albums: []string{"as2"}, Labels: []string{"cat"}, People: []string{"js1"}},
+		Interval: settings.Seconds(30 * time.Second), Fit: "fill", Layout: "clock",
+		Colour: settings.Colour{Brightness: 60, Gamma: 1.2, Night: 3000},
+	}
+	if got := settings.Current(); !got.Playlist.Equal(want.Playlist) || got.Interval != want.Interval || got.Fit != want.Fit ||
+		got.Layout != want.Layout || got.Colour != want.Colour {
+		t.Errorf("saved %+v, want %+v", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	settingsHandler(w, httptest.NewRequest("GET", "/settings", nil))
+	page := w.Body.String()
+	for _, s := range []string{
+		`value="as1">`, `value="as2" checked>`, `/settings/thumb/abc`, // Albums
+		`value="js1" checked>`, "PhotoPrism is down", // Person kept while PhotoPrism can't list them
+		`value="30"`, `<option selected>clock</option>`,
+		`name="brightness" type="number" min="5" max="100" size="4" value="60"`, `value="1.2"`,
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("page is missing %s", s)
+		}
+	}
+
+	for _, bad := range []string{"interval=2", "night=900", "gamma=bright"} {
+		req = httptest.NewRequest("POST", "/settings", strings.NewReader(bad))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+		settingsHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", bad, w.Code)
+		}
+	}
+	if settings.Current().Interval != want.Interval {
+		t.Error("bad settings were saved")
+	}
+}
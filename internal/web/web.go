@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/drummonds/gophoto/internal/fb"
@@ -27,9 +28,42 @@ func HelloServer(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "")
 	fmt.Fprintf(w, "<h1>Hello  from gophoto</h1>")
 	fmt.Fprintf(w, "<title>FrameBuffer</title>")
+	fmt.Fprintf(w, "<p><a href='/live'>See what the frame is showing</a> or <a href='/remote'>control it</a> or change its <a href='/settings'>settings</a> and <a href='/audiences'>audiences</a></p>")
 	fmt.Fprintf(w, "<img src='static/image/P1120981.png' alt='Chimp' style='width:800px;'>")
 }
 
+// Status shown at the top of the diagnostics page, set by the rest of the
+// program as things happen.
+var (
+	statusMu    sync.Mutex
+	status      = make(map[string]string)
+	statusOrder []string
+)
+
+// SetStatus records how something is going for the diagnostics page, eg
+// which mode the frame buffer ended up in.
+func SetStatus(name, value string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if _, ok := status[name]; !ok {
+		statusOrder = append(statusOrder, name)
+	}
+	status[name] = value
+}
+
+func addStatus(sb *strings.Builder) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if len(statusOrder) == 0 {
+		return
+	}
+	sb.WriteString("<h2>Status</h2><ul>")
+	for _, name := range statusOrder {
+		sb.WriteString(fmt.Sprintf("<li>%s: %s</li>", template.HTMLEscapeString(name), template.HTMLEscapeString(status[name])))
+	}
+	sb.WriteString("</ul>")
+}
+
 type Page struct {
 	Title string
 	Body  template.HTML
@@ -118,6 +152,7 @@ func diagHandler(w http.ResponseWriter, r *http.Request) {
 	page := &Page{Title: "FrameBuffer"}
 	var sb strings.Builder
 	sb.WriteString("<h1>Hello  from gophoto</h1>")
+	addStatus(&sb)
 	addFrameBufferInfo(&sb)
 	sb.WriteString("<title>FrameBuffer</title>")
 	sb.WriteString("<img src='static/image/P1120981.png' alt='Chimp' style='width:800px;'>")
@@ -136,6 +171,13 @@ func StartWebServer() {
 
 	http.HandleFunc("/", HelloServer)
 	http.HandleFunc("/diag", diagHandler)
+	http.HandleFunc("/live", liveHandler)
+	http.HandleFunc("/live.mjpeg", liveStreamHandler)
+	http.HandleFunc("/remote", remoteHandler)
+	http.HandleFunc("/api/", apiHandler)
+	http.HandleFunc("/settings", settingsHandler)
+	http.HandleFunc("/settings/thumb/", thumbHandler)
+	http.HandleFunc("/audiences", audiencesHandler)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(content))))
 	// http.HandleFunc("/", index_handler)
 	// http.HandleFunc("/about/", about_handler)